@@ -0,0 +1,177 @@
+package tomltest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// BenchDoc is a document to benchmark.
+type BenchDoc struct {
+	Name string // Test path or name of the generated document.
+	TOML string // Input for the decoder.
+	JSON string // Input for the encoder.
+}
+
+// BenchResult is the result of benchmarking a single document.
+type BenchResult struct {
+	Size   int           `json:"size"`   // Size of the input in bytes.
+	Runs   int           `json:"runs"`   // Number of runs.
+	Min    time.Duration `json:"min"`    // Fastest run.
+	Median time.Duration `json:"median"` // Median of all runs.
+	P95    time.Duration `json:"p95"`    // 95th percentile of all runs.
+	Error  string        `json:"error"`  // Parser failed or rejected the input; the other fields aren't set.
+}
+
+// BenchDocs gets the valid tests in RunTests and not in SkipTests, to use as
+// benchmark documents. Variants are ignored.
+func (r Runner) BenchDocs() ([]BenchDoc, error) {
+	if _, err := r.prepare(); err != nil {
+		return nil, fmt.Errorf("tomltest.Runner.BenchDocs: %w", err)
+	}
+
+	docs := make([]BenchDoc, 0, len(r.RunTests))
+	for _, p := range r.RunTests {
+		t := r.newTest(p)
+		if t.Type() != TypeValid || t.Variant() != "" || r.hasSkip(p) {
+			continue
+		}
+		_, in, err := t.ReadInput(r.Files)
+		if err != nil {
+			return nil, fmt.Errorf("tomltest.Runner.BenchDocs: %w", err)
+		}
+		_, want, err := t.ReadWant(r.Files)
+		if err != nil {
+			return nil, fmt.Errorf("tomltest.Runner.BenchDocs: %w", err)
+		}
+		docs = append(docs, BenchDoc{Name: p, TOML: in, JSON: want})
+	}
+	return docs, nil
+}
+
+// GenerateBenchDocs generates large documents of about size bytes to
+// benchmark:
+//
+//	wide-table        Single table with many keys.
+//	long-array        Single array with many integers.
+//	deep-nesting      Many deeply nested arrays and inline tables.
+//	huge-string       Single long string, with some escapes.
+//	array-of-tables   Many [[array]] tables with mixed value types.
+func GenerateBenchDocs(size int) ([]BenchDoc, error) {
+	gen := []struct {
+		name string
+		gen  func(b *strings.Builder, i int)
+	}{
+		{"wide-table", func(b *strings.Builder, i int) {
+			if i == 0 {
+				b.WriteString("[table]\n")
+			}
+			fmt.Fprintf(b, "key_%d = %d\n", i, i)
+		}},
+		{"long-array", func(b *strings.Builder, i int) {
+			if i == 0 {
+				b.WriteString("array = [\n")
+			}
+			fmt.Fprintf(b, "  %d,\n", i)
+		}},
+		{"deep-nesting", func(b *strings.Builder, i int) {
+			const depth = 32
+			fmt.Fprintf(b, "deep_%d = ", i)
+			for j := 0; j < depth; j++ {
+				b.WriteString("[{a = ")
+			}
+			b.WriteString("1")
+			for j := 0; j < depth; j++ {
+				b.WriteString("}]")
+			}
+			b.WriteByte('\n')
+		}},
+		{"huge-string", func(b *strings.Builder, i int) {
+			if i == 0 {
+				b.WriteString(`string = "`)
+			}
+			b.WriteString(`Lorem ipsum dolor sit amet, \"consectetur\" adipiscing elit.\n\tÜñíçødé é `)
+		}},
+		{"array-of-tables", func(b *strings.Builder, i int) {
+			fmt.Fprintf(b, "[[array]]\nint = %d\nfloat = %d.5\nstr = \"string %d\"\n"+
+				"bool = true\ndate = 2006-01-02T15:04:05Z\narr = [1, 2, 3]\n\n", i, i, i)
+		}},
+	}
+
+	docs := make([]BenchDoc, 0, len(gen))
+	for _, g := range gen {
+		b := new(strings.Builder)
+		b.Grow(size + 1024)
+		for i := 0; b.Len() < size; i++ {
+			g.gen(b, i)
+		}
+		switch g.name {
+		case "long-array":
+			b.WriteString("]\n")
+		case "huge-string":
+			b.WriteString("\"\n")
+		}
+
+		var v any
+		if _, err := toml.Decode(b.String(), &v); err != nil {
+			return nil, fmt.Errorf("tomltest.GenerateBenchDocs: %s: %w", g.name, err)
+		}
+		tagged, err := AddTags(v)
+		if err != nil {
+			return nil, fmt.Errorf("tomltest.GenerateBenchDocs: %s: %w", g.name, err)
+		}
+		j, err := json.Marshal(tagged)
+		if err != nil {
+			return nil, fmt.Errorf("tomltest.GenerateBenchDocs: %s: %w", g.name, err)
+		}
+		docs = append(docs, BenchDoc{Name: g.name, TOML: b.String(), JSON: string(j)})
+	}
+	return docs, nil
+}
+
+// Bench runs the parser n times with the input, after one warmup run.
+//
+// Every run uses Runner.Timeout; Runner.Validity and Runner.RejectExitCodes
+// are used to decide if the parser rejected the input.
+func (r Runner) Bench(ctx context.Context, p Parser, input string, n int) BenchResult {
+	if r.Timeout == 0 {
+		r.Timeout = 1 * time.Second
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	var (
+		t     = r.newTest("")
+		res   = BenchResult{Size: len(input)}
+		times = make([]time.Duration, 0, n)
+	)
+	t.Input = input
+	for i := 0; i < n+1; i++ {
+		run, err := t.runParser(ctx, p)
+		if err == nil && run.OutputFromStderr {
+			err = fmt.Errorf("input rejected: %s", strings.TrimSpace(run.Output))
+		}
+		if err != nil {
+			return BenchResult{Size: len(input), Error: err.Error()}
+		}
+		if i > 0 {
+			times = append(times, run.Duration)
+		}
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	res.Runs = len(times)
+	res.Min = times[0]
+	res.Median = times[len(times)/2]
+	if len(times)%2 == 0 {
+		res.Median = (times[len(times)/2-1] + times[len(times)/2]) / 2
+	}
+	res.P95 = times[(len(times)*95+99)/100-1]
+	return res
+}
@@ -0,0 +1,46 @@
+package tomltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	docs, err := GenerateBenchDocs(4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests, err := NewRunner(Runner{RunTests: []string{"valid/string/*"}}).BenchDocs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) == 0 {
+		t.Fatal("no tests")
+	}
+
+	r := NewRunner(Runner{})
+	p := FuncParser{Decode: func(ctx context.Context, data []byte) (any, error) {
+		if string(data) == "reject" {
+			return nil, errors.New("rejected")
+		}
+		return tomlDecode(ctx, data)
+	}}
+	for _, d := range append(docs, tests...) {
+		if len(d.TOML) < 4096 && d.Name[0] != 'v' {
+			t.Errorf("%s: too small: %d", d.Name, len(d.TOML))
+		}
+		res := r.Bench(context.Background(), p, d.TOML, 5)
+		if res.Error != "" {
+			t.Fatalf("%s: %s", d.Name, res.Error)
+		}
+		if res.Runs != 5 || res.Size != len(d.TOML) || res.Min > res.Median || res.Median > res.P95 {
+			t.Errorf("%s: %#v", d.Name, res)
+		}
+	}
+
+	res := r.Bench(context.Background(), p, "reject", 5)
+	if res.Error == "" || res.Runs != 0 {
+		t.Errorf("%#v", res)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	tomltest "github.com/toml-lang/toml-test/v2"
+	"zgo.at/zli"
+)
+
+// benchDoc is the result for a single document, for all parsers.
+type benchDoc struct {
+	Name    string                 `json:"name"`
+	Size    int                    `json:"size"`
+	Results []tomltest.BenchResult `json:"results"`
+}
+
+// benchReport is the benchmark result for either the decoders or the encoder.
+type benchReport struct {
+	Parsers   [][]string             `json:"parsers"`
+	Startup   []tomltest.BenchResult `json:"startup"`
+	Documents []benchDoc             `json:"documents"`
+}
+
+func cmdBench(f zli.Flags) {
+	var (
+		decoder     = f.String("", "decoder")
+		encoder     = f.String("", "encoder")
+		decoderMode = f.String("exec", "decoder-mode")
+		encoderMode = f.String("exec", "encoder-mode")
+		compare     = f.StringList(nil, "compare")
+		tomlVersion = f.String(tomltest.DefaultVersion, "toml")
+		skip        = f.StringList(nil, "skip")
+		run         = f.StringList(nil, "run")
+		n           = f.Int(10, "n")
+		size        = f.Int(256, "size")
+		timeout     = f.String("10s", "timeout")
+		noTests     = f.Bool(false, "no-tests")
+		verbose     = f.Bool(false, "v")
+		asJSON      = f.Bool(false, "json")
+		validity    = f.String("stderr", "validity")
+		rejectCodes = f.StringList(nil, "reject-exit-codes")
+		env         = f.StringList(nil, "env")
+		shell       = f.Bool(false, "shell")
+	)
+	zli.F(f.Parse())
+	if len(f.Args) > 0 {
+		zli.Fatalf("no positional arguments allowed")
+	}
+	if decoder.String() == "" && len(compare.Strings()) == 0 {
+		zli.Fatalf("must have -decoder or -compare command")
+	}
+	if n.Int() < 1 {
+		zli.Fatalf("-n must be at least 1")
+	}
+	dur, err := time.ParseDuration(timeout.String())
+	zli.F(err)
+	for _, e := range env.Strings() {
+		if k, _, ok := strings.Cut(e, "="); !ok || k == "" {
+			zli.Fatalf("invalid -env: %q (must be KEY=VAL)", e)
+		}
+	}
+
+	runner := tomltest.NewRunner(tomltest.Runner{
+		RunTests:        run.StringsSplit(","),
+		SkipTests:       skip.StringsSplit(","),
+		Version:         tomlVersion.String(),
+		Timeout:         dur,
+		Validity:        validity.String(),
+		RejectExitCodes: parseValidity(validity.String(), rejectCodes.StringsSplit(",")),
+		Env:             env.Strings(),
+	})
+
+	docs, err := tomltest.GenerateBenchDocs(size.Int() * 1024)
+	zli.F(err)
+	var tests []tomltest.BenchDoc
+	if !noTests.Bool() {
+		tests, err = runner.BenchDocs()
+		zli.F(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var decoders []string
+	if decoder.String() != "" {
+		decoders = append(decoders, decoder.String())
+	}
+	decoders = append(decoders, compare.Strings()...)
+
+	var reports []benchReport
+	dec := make([]tomltest.Parser, 0, len(decoders))
+	for _, d := range decoders {
+		dec = append(dec, newParser("-decoder", decoderMode.String(), d, 1, shell.Bool()))
+	}
+	reports = append(reports, runBench(ctx, runner, dec, docs, tests, false, n.Int(), verbose.Bool()))
+	if encoder.String() != "" {
+		enc := newParser("-encoder", encoderMode.String(), encoder.String(), 1, shell.Bool())
+		reports = append(reports, runBench(ctx, runner, []tomltest.Parser{enc}, docs, tests, true, n.Int(), verbose.Bool()))
+	}
+	if ctx.Err() != nil {
+		zli.Fatalf("interrupted")
+	}
+
+	if asJSON.Bool() {
+		newEnc().Encode(struct {
+			Version  string       `json:"version"`
+			TOML     string       `json:"toml"`
+			Runs     int          `json:"runs"`
+			Decoders benchReport  `json:"decoders"`
+			Encoder  *benchReport `json:"encoder"`
+		}{fmt.Sprintf("toml-test %s", zli.Version()), runner.Version, n.Int(), reports[0], func() *benchReport {
+			if len(reports) > 1 {
+				return &reports[1]
+			}
+			return nil
+		}()})
+		return
+	}
+
+	fmt.Printf("toml-test %s; %d runs per document\n", zli.Version(), n.Int())
+	for i, r := range reports {
+		fmt.Println()
+		if i == 0 {
+			printBench("decoder", r)
+		} else {
+			printBench("encoder", r)
+		}
+	}
+}
+
+// runBench runs all documents for all parsers. Tests are added as a single
+// "valid tests" row, unless verbose is set.
+func runBench(ctx context.Context, runner tomltest.Runner, parsers []tomltest.Parser,
+	docs, tests []tomltest.BenchDoc, encoder bool, n int, verbose bool,
+) benchReport {
+	defer func() {
+		for _, p := range parsers {
+			closeParser(p)
+		}
+	}()
+
+	input := func(d tomltest.BenchDoc) string {
+		if encoder {
+			return d.JSON
+		}
+		return d.TOML
+	}
+
+	report := benchReport{
+		Parsers:   make([][]string, 0, len(parsers)),
+		Startup:   make([]tomltest.BenchResult, 0, len(parsers)),
+		Documents: make([]benchDoc, 0, len(docs)+len(tests)),
+	}
+	empty := tomltest.BenchDoc{TOML: "", JSON: "{}"}
+	for _, p := range parsers {
+		report.Parsers = append(report.Parsers, p.Cmd())
+		report.Startup = append(report.Startup, runner.Bench(ctx, p, input(empty), n))
+	}
+
+	for _, d := range docs {
+		bd := benchDoc{Name: d.Name, Size: len(input(d))}
+		for _, p := range parsers {
+			bd.Results = append(bd.Results, runner.Bench(ctx, p, input(d), n))
+		}
+		report.Documents = append(report.Documents, bd)
+	}
+
+	if len(tests) == 0 {
+		return report
+	}
+	if verbose {
+		for _, d := range tests {
+			bd := benchDoc{Name: d.Name, Size: len(input(d))}
+			for _, p := range parsers {
+				bd.Results = append(bd.Results, runner.Bench(ctx, p, input(d), n))
+			}
+			report.Documents = append(report.Documents, bd)
+		}
+		return report
+	}
+
+	// Add up the results for all tests; tests that fail are not counted.
+	bd := benchDoc{Name: fmt.Sprintf("valid tests (%d)", len(tests))}
+	for _, p := range parsers {
+		var total tomltest.BenchResult
+		for _, d := range tests {
+			r := runner.Bench(ctx, p, input(d), n)
+			if r.Error != "" {
+				continue
+			}
+			total.Size += r.Size
+			total.Runs += r.Runs
+			total.Min += r.Min
+			total.Median += r.Median
+			total.P95 += r.P95
+		}
+		if total.Runs == 0 {
+			total.Error = "all tests failed"
+		}
+		if total.Size > bd.Size {
+			bd.Size = total.Size
+		}
+		bd.Results = append(bd.Results, total)
+	}
+	report.Documents = append(report.Documents, bd)
+	return report
+}
+
+func printBench(kind string, r benchReport) {
+	if len(r.Parsers) == 1 {
+		fmt.Printf("%s: %s\n", kind, r.Parsers[0])
+		fmt.Printf("startup overhead: %s (median for empty document; subtracted in \"net\")\n\n",
+			benchStartup(r.Startup[0]))
+		fmt.Printf("%-20s %7s %10s %10s %10s %9s\n", "document", "size", "median", "p95", "net", "MB/s")
+		for _, d := range r.Documents {
+			res := d.Results[0]
+			fmt.Printf("%-20s %7s ", d.Name, fmtSize(d.Size))
+			if res.Error != "" {
+				fmt.Println(zli.Colorize("error: "+firstLine(res.Error), hlErr))
+				continue
+			}
+			net, mbs := benchNet(res, r.Startup[0])
+			fmt.Printf("%10s %10s %10s %9s\n", fmtDur(res.Median), fmtDur(res.P95), net, mbs)
+		}
+		return
+	}
+
+	fmt.Printf("%ss:\n", kind)
+	for i, p := range r.Parsers {
+		fmt.Printf("    [%d] %s\n", i+1, p)
+	}
+	fmt.Println()
+
+	fmt.Printf("%-20s %7s", "document", "size")
+	for i := range r.Parsers {
+		fmt.Printf(" %10s %7s", fmt.Sprintf("[%d] net", i+1), "MB/s")
+	}
+	fmt.Printf("\n%-20s %7s", "startup overhead", "")
+	for _, s := range r.Startup {
+		if s.Error != "" {
+			fmt.Printf(" %10s %7s", "error", "")
+		} else {
+			fmt.Printf(" %10s %7s", fmtDur(s.Median), "")
+		}
+	}
+	fmt.Println()
+	for _, d := range r.Documents {
+		fmt.Printf("%-20s %7s", d.Name, fmtSize(d.Size))
+		for i, res := range d.Results {
+			if res.Error != "" {
+				fmt.Printf(" %10s %7s", "error", "")
+				continue
+			}
+			net, mbs := benchNet(res, r.Startup[i])
+			fmt.Printf(" %10s %7s", net, mbs)
+		}
+		fmt.Println()
+	}
+}
+
+func benchStartup(s tomltest.BenchResult) string {
+	if s.Error != "" {
+		return "error: " + firstLine(s.Error)
+	}
+	return fmtDur(s.Median)
+}
+
+// benchNet gets the median with the startup overhead subtracted, and the
+// throughput in MB/s. For the combined valid tests the startup overhead is
+// subtracted once for every test.
+//
+// Both are "-" if the startup overhead is larger than the median.
+func benchNet(res, startup tomltest.BenchResult) (string, string) {
+	if startup.Error != "" || startup.Runs == 0 {
+		return "-", "-"
+	}
+	net := res.Median - startup.Median*time.Duration(res.Runs/startup.Runs)
+	if net <= 0 {
+		return "-", "-"
+	}
+	return fmtDur(net), fmt.Sprintf("%.1f", float64(res.Size)/1e6/net.Seconds())
+}
+
+func fmtSize(n int) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1fM", float64(n)/1024/1024)
+	case n >= 1024:
+		return fmt.Sprintf("%.1fK", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
+
+func fmtDur(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%.0fµs", float64(d)/float64(time.Microsecond))
+	}
+}
+
+func firstLine(s string) string {
+	l, _, _ := strings.Cut(s, "\n")
+	return l
+}
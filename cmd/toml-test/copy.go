@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 
@@ -21,33 +21,27 @@ func cmdCopy(f zli.Flags) {
 
 	r := tomltest.NewRunner(tomltest.Runner{Version: tomlVersion.String()})
 	files := getList(r)
-	files = append(files, ".gitattributes")
 
 	d := f.Args[0]
 	err := os.MkdirAll(d, 0o777)
 	zli.F(err)
 
-	fsys := tomltest.TestCases()
 	for _, f := range files {
-		srcfp, err := fsys.Open(f)
+		data, err := f.read(r)
 		zli.F(err)
 
-		err = os.MkdirAll(filepath.Dir(filepath.Join(d, f)), 0o777)
+		err = os.MkdirAll(filepath.Dir(filepath.Join(d, f.name)), 0o777)
 		zli.F(err)
 
-		dstfp, err := os.Create(filepath.Join(d, f))
-		zli.F(err)
-
-		_, err = io.Copy(dstfp, srcfp)
-		zli.F(err)
-
-		err = srcfp.Close()
-		zli.F(err)
-
-		err = dstfp.Close()
+		err = os.WriteFile(filepath.Join(d, f.name), []byte(data), 0o666)
 		zli.F(err)
 	}
 
+	attr, err := fs.ReadFile(r.Files, ".gitattributes")
+	zli.F(err)
+	err = os.WriteFile(filepath.Join(d, ".gitattributes"), attr, 0o666)
+	zli.F(err)
+
 	err = os.WriteFile(filepath.Join(d, "version.toml"), fmt.Appendf(nil, `
 # Update with:
 #     rm -r [this-dir]
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	tomltest "github.com/toml-lang/toml-test/v2"
+	"zgo.at/jfmt"
+	"zgo.at/zli"
+)
+
+func cmdDiffImpl(f zli.Flags) {
+	var (
+		decoders    = f.StringList(nil, "decoder")
+		decoderMode = f.String("exec", "decoder-mode")
+		tomlVersion = f.String(tomltest.DefaultVersion, "toml")
+		skip        = f.StringList(nil, "skip")
+		run         = f.StringList(nil, "run")
+		parallel    = f.Int(runtime.NumCPU(), "parallel")
+		timeout     = f.String("1s", "timeout")
+		verbose     = f.Bool(false, "v")
+		asJSON      = f.Bool(false, "json")
+		validity    = f.String("stderr", "validity")
+		rejectCodes = f.StringList(nil, "reject-exit-codes")
+		env         = f.StringList(nil, "env")
+		shell       = f.Bool(false, "shell")
+	)
+	zli.F(f.Parse())
+	if len(decoders.Strings()) < 2 {
+		zli.Fatalf("need at least two -decoder commands")
+	}
+	dur, err := time.ParseDuration(timeout.String())
+	zli.F(err)
+
+	runner := tomltest.NewRunner(tomltest.Runner{
+		RunTests:        run.StringsSplit(","),
+		SkipTests:       skip.StringsSplit(","),
+		Version:         tomlVersion.String(),
+		Parallel:        parallel.Int(),
+		Timeout:         dur,
+		Validity:        validity.String(),
+		RejectExitCodes: parseValidity(validity.String(), rejectCodes.StringsSplit(",")),
+		Env:             env.Strings(),
+	})
+
+	var docs []tomltest.DiffDoc
+	if len(f.Args) > 0 {
+		if run.Set() || skip.Set() {
+			zli.Fatalf("can't use -run or -skip with files")
+		}
+		docs, err = readDiffDocs(f.Args)
+	} else {
+		docs, err = runner.DiffDocs()
+	}
+	zli.F(err)
+
+	dec := make([]tomltest.Parser, 0, len(decoders.Strings()))
+	for _, d := range decoders.Strings() {
+		dec = append(dec, newParser("-decoder", decoderMode.String(), d, parallel.Int(), shell.Bool()))
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	diffs := runner.Diff(ctx, dec, docs)
+	partial := ctx.Err() != nil
+	stop()
+	for _, p := range dec {
+		closeParser(p)
+	}
+
+	var disagree int
+	for _, d := range diffs {
+		if d.Disagree() {
+			disagree++
+		}
+	}
+
+	if asJSON.Bool() {
+		show := make([]tomltest.Diff, 0, len(diffs))
+		for _, d := range diffs {
+			if d.Disagree() || verbose.Bool() {
+				show = append(show, d)
+			}
+		}
+		cmds := make([][]string, 0, len(dec))
+		for _, p := range dec {
+			cmds = append(cmds, p.Cmd())
+		}
+		newEnc().Encode(struct {
+			Version   string          `json:"version"`
+			TOML      string          `json:"toml"`
+			Decoders  [][]string      `json:"decoders"`
+			Partial   bool            `json:"partial"`
+			Total     int             `json:"total"`
+			Disagree  int             `json:"disagree"`
+			Documents []tomltest.Diff `json:"documents"`
+		}{fmt.Sprintf("toml-test %s", zli.Version()), runner.Version, cmds,
+			partial, len(diffs), disagree, show})
+	} else {
+		printDiff(dec, diffs, verbose.Bool())
+		if partial {
+			fmt.Println(zli.Colorize("interrupted: not all documents were run", hlErr))
+		}
+		fmt.Printf("toml-test %s; %d documents, %d disagreements\n", zli.Version(), len(diffs), disagree)
+	}
+
+	if disagree > 0 || partial {
+		zli.Exit(1)
+	}
+}
+
+// readDiffDocs reads the files in paths; directories are read recursively for
+// *.toml files.
+func readDiffDocs(paths []string) ([]tomltest.DiffDoc, error) {
+	var docs []tomltest.DiffDoc
+	add := func(path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, tomltest.DiffDoc{Name: path, Input: string(data)})
+		return nil
+	}
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			if err := add(p); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !strings.HasSuffix(path, ".toml") {
+				return nil
+			}
+			return add(path)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// printDiff prints the documents where the decoders disagree, or all documents
+// if verbose is set.
+func printDiff(dec []tomltest.Parser, diffs []tomltest.Diff, verbose bool) {
+	fmt.Println("decoders:")
+	for i, p := range dec {
+		fmt.Printf("    [%d] %s\n", i+1, p.Cmd())
+	}
+	fmt.Println()
+
+	for _, d := range diffs {
+		if !d.Disagree() && !verbose {
+			continue
+		}
+		b := new(strings.Builder)
+		if d.Disagree() {
+			b.WriteString(zli.Colorize("DIFF", hlErr))
+			b.WriteByte(' ')
+			b.WriteString(zli.Colorize(d.Name, zli.Bold))
+		} else {
+			b.WriteString("SAME ")
+			b.WriteString(d.Name)
+		}
+		switch d.Expect {
+		case tomltest.OutcomePassed:
+			b.WriteString(" (valid test)")
+		case tomltest.OutcomeRejected:
+			b.WriteString(" (invalid test)")
+		}
+		b.WriteByte('\n')
+		if d.Disagree() {
+			b.WriteString(indentWith(indent(d.Failure, 4, false), zli.Colorize(" ", hlErr)))
+			b.WriteByte('\n')
+		}
+
+		showStream(b, "input", d.Input)
+		for i, o := range d.Outputs {
+			out := o.Output
+			if o.Outcome == tomltest.OutcomePassed {
+				if j, err := jfmt.NewFormatter(0, "", "  ").FormatString(out); err == nil {
+					out = j
+				}
+			}
+			outcome := o.Outcome.String()
+			if o.Outcome == tomltest.OutcomePassed {
+				outcome = "accepted"
+			}
+			showStream(b, fmt.Sprintf("[%d] %s (exit %d; %s)", i+1, outcome, o.ExitCode,
+				o.Duration.Round(time.Microsecond)), out)
+		}
+		b.WriteByte('\n')
+		fmt.Print(b.String())
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	tomltest "github.com/toml-lang/toml-test/v2"
+	"zgo.at/zli"
+)
+
+// writeErrors writes the errors file for -update-errors, if set.
+func writeErrors(file string, runners []tomltest.Runner, results []tomltest.Tests) {
+	if file == "" {
+		return
+	}
+	for _, tests := range results {
+		if tests.Partial {
+			fmt.Fprintf(os.Stderr, "not all tests were run; not writing %s\n", file)
+			return
+		}
+	}
+	n, err := updateErrors(file, runners, results)
+	if err != nil {
+		zli.Fatalf("-update-errors: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d errors to %s\n", n, file)
+}
+
+// updateErrors writes the normalized output of all invalid tests that were
+// rejected to the errors file.
+//
+// Existing entries for other tests and other TOML versions are kept; see
+// mergeSnapshot.
+func updateErrors(file string, runners []tomltest.Runner, results []tomltest.Tests) (int, error) {
+	isJSON := strings.HasSuffix(file, ".json")
+	raw := make(map[string]any)
+	data, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = nil
+	case err != nil:
+		return 0, err
+	case isJSON:
+		err = json.Unmarshal(data, &raw)
+	default:
+		_, err = toml.Decode(string(data), &raw)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Existing keys may be written with or without "invalid/" and ".toml".
+	keys := make(map[string]string, len(raw))
+	for k := range raw {
+		nk := k
+		if !strings.HasPrefix(nk, "invalid/") && !strings.HasPrefix(nk, "valid/") {
+			nk = path.Join("invalid", nk)
+		}
+		keys[strings.TrimSuffix(nk, ".toml")] = k
+	}
+
+	snap := make(map[string]map[string]string)
+	for i, tests := range results {
+		for _, t := range tests.Tests {
+			if !t.Invalid() || t.Variant() != "" || !t.OutputFromStderr ||
+				(t.Outcome != tomltest.OutcomePassed && t.Outcome != tomltest.OutcomeWrongPosition) {
+				continue
+			}
+			out, err := tomltest.NormalizeOutput(t.Output, t.PID, runners[i].NormalizeErrors)
+			if err != nil {
+				return 0, err
+			}
+			if out == "" {
+				continue
+			}
+			if snap[t.Path] == nil {
+				snap[t.Path] = make(map[string]string, len(runners))
+			}
+			snap[t.Path][runners[i].Version] = out
+		}
+	}
+
+	for p, byVersion := range snap {
+		k, ok := keys[p]
+		if !ok {
+			k = strings.TrimPrefix(p, "invalid/")
+		}
+		raw[k], err = mergeSnapshot(raw[k], byVersion)
+		if err != nil {
+			return 0, fmt.Errorf("%q: %w", k, err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if isJSON {
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "    ")
+		err = enc.Encode(raw)
+	} else {
+		err = toml.NewEncoder(buf).Encode(raw)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(snap), os.WriteFile(file, buf.Bytes(), 0o644)
+}
+
+// mergeSnapshot merges the output for the TOML versions in byVersion with the
+// existing entry in the errors file.
+//
+// Only the parts of the existing entry for versions in byVersion are replaced;
+// the rest is kept and scoped to the versions it still applies to. Snapshots
+// are always written as a table with "contains", so that output which looks
+// like a "/regexp/" is never read as one.
+func mergeSnapshot(existing any, byVersion map[string]string) (any, error) {
+	all := tomltest.Versions()
+	entries := make([]any, 0, 4)
+	for _, e := range entryList(existing) {
+		scope := all
+		var tbl map[string]any
+		switch ee := e.(type) {
+		case string:
+			tbl = map[string]any{"contains": ee}
+			if len(ee) > 1 && ee[0] == '/' && ee[len(ee)-1] == '/' {
+				tbl = map[string]any{"regex": ee[1 : len(ee)-1]}
+			}
+		case map[string]any:
+			tbl = make(map[string]any, len(ee))
+			for k, v := range ee {
+				tbl[k] = v
+			}
+			if v, ok := ee["toml"]; ok {
+				var err error
+				scope, err = parseScope(v)
+				if err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("must be a string, table, or list, not %T", e)
+		}
+
+		keep := make([]string, 0, len(scope))
+		for _, v := range scope {
+			if _, ok := byVersion[v]; !ok {
+				keep = append(keep, v)
+			}
+		}
+		switch {
+		case len(keep) == 0:
+		case len(keep) == len(scope):
+			entries = append(entries, e)
+		default:
+			tbl["toml"] = versionValue(keep)
+			entries = append(entries, tbl)
+		}
+	}
+
+	versions := make([]string, 0, len(byVersion))
+	for v := range byVersion {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	for len(versions) > 0 {
+		var (
+			msg   = byVersion[versions[0]]
+			group []string
+			rest  []string
+		)
+		for _, v := range versions {
+			if byVersion[v] == msg {
+				group = append(group, v)
+			} else {
+				rest = append(rest, v)
+			}
+		}
+		versions = rest
+
+		tbl := map[string]any{"contains": msg}
+		if len(group) != len(all) {
+			tbl["toml"] = versionValue(group)
+		}
+		entries = append(entries, tbl)
+	}
+
+	if len(entries) == 1 {
+		return entries[0], nil
+	}
+	return entries, nil
+}
+
+// entryList gets an entry in the errors file as a list.
+func entryList(v any) []any {
+	switch vv := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return vv
+	case []map[string]any:
+		l := make([]any, 0, len(vv))
+		for _, t := range vv {
+			l = append(l, t)
+		}
+		return l
+	}
+	return []any{v}
+}
+
+// parseScope parses the "toml" key of an entry in the errors file.
+func parseScope(v any) ([]string, error) {
+	var l []string
+	switch vv := v.(type) {
+	case string:
+		l = []string{vv}
+	case []any:
+		for _, s := range vv {
+			ss, ok := s.(string)
+			if !ok {
+				return nil, fmt.Errorf(`"toml" must be a string or list of strings`)
+			}
+			l = append(l, ss)
+		}
+	default:
+		return nil, fmt.Errorf(`"toml" must be a string or list of strings`)
+	}
+	scope := make([]string, 0, len(l))
+	for _, s := range l {
+		vv, err := tomltest.ParseVersions(s)
+		if err != nil || len(vv) != 1 || s == "all" {
+			return nil, fmt.Errorf(`unknown version %q in "toml"`, s)
+		}
+		scope = append(scope, vv[0])
+	}
+	return scope, nil
+}
+
+func versionValue(v []string) any {
+	if len(v) == 1 {
+		return v[0]
+	}
+	return v
+}
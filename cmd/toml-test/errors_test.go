@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	tomltest "github.com/toml-lang/toml-test/v2"
+)
+
+func TestUpdateErrors(t *testing.T) {
+	tests := []struct {
+		existing string
+		output   map[string]string // TOML version → output
+		want     string
+	}{
+		{``, map[string]string{"1.1.0": "error"},
+			`super-twice: contains "error" (1.1.0)`},
+		{``, map[string]string{"1.0.0": "error", "1.1.0": "error"},
+			`super-twice: contains "error"`},
+		{``, map[string]string{"1.0.0": "A", "1.1.0": "B"},
+			`super-twice: contains "A" (1.0.0) | contains "B" (1.1.0)`},
+
+		// Output that looks like a regexp.
+		{``, map[string]string{"1.1.0": "/error/"},
+			`super-twice: contains "/error/" (1.1.0)`},
+
+		// Keep other versions and other tests.
+		{`"table/super-twice" = [{toml = "1.0", contains = "A"}, {toml = "1.1", contains = "B"}]`,
+			map[string]string{"1.1.0": "C"},
+			`super-twice: contains "A" (1.0) | contains "C" (1.1.0)`},
+		{`"table/super-twice" = [{toml = ["1.0", "1.1"], contains = "A", line = 2}]`,
+			map[string]string{"1.1.0": "C"},
+			`super-twice: contains "A" and is on line 2 (1.0.0) | contains "C" (1.1.0)`},
+		{`"table/super-twice" = '/A/'`,
+			map[string]string{"1.1.0": "C"},
+			`super-twice: matches /A/ (1.0.0) | contains "C" (1.1.0)`},
+		{`"table/super-twice" = 'A'` + "\n" + `"other" = "X"`,
+			map[string]string{"1.0.0": "C", "1.1.0": "C"},
+			`other: contains "X"` + "\n" + `super-twice: contains "C"`},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "errors.toml")
+			if tt.existing != "" {
+				err := os.WriteFile(file, []byte(tt.existing), 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var (
+				runners []tomltest.Runner
+				results []tomltest.Tests
+			)
+			for _, v := range []string{"1.0.0", "1.1.0"} {
+				out, ok := tt.output[v]
+				if !ok {
+					continue
+				}
+				runners = append(runners, tomltest.Runner{Version: v})
+				results = append(results, tomltest.Tests{Tests: []tomltest.Test{{
+					Path:             "invalid/table/super-twice",
+					Outcome:          tomltest.OutcomePassed,
+					Output:           out,
+					OutputFromStderr: true,
+				}}})
+			}
+
+			if _, err := updateErrors(file, runners, results); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			errs, err := tomltest.ParseErrors(data, false)
+			if err != nil {
+				t.Fatalf("%s\n%s", err, data)
+			}
+
+			have := make([]string, 0, len(errs))
+			for k, m := range errs {
+				l := make([]string, 0, len(m))
+				for _, e := range m {
+					s := e.String()
+					if len(e.Versions) > 0 {
+						s += " (" + strings.Join(e.Versions, ", ") + ")"
+					}
+					l = append(l, s)
+				}
+				have = append(have, strings.TrimPrefix(k, "table/")+": "+strings.Join(l, " | "))
+			}
+			sort.Strings(have)
+			if h := strings.Join(have, "\n"); h != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s\nfile:\n%s", h, tt.want, data)
+			}
+		})
+	}
+}
+
+// Write a snapshot for all versions, and run the tests against it for every
+// version.
+func TestUpdateErrorsRun(t *testing.T) {
+	newRunner := func(version string, errs map[string][]tomltest.ErrorMatch) tomltest.Runner {
+		return tomltest.NewRunner(tomltest.Runner{
+			Version:         version,
+			ErrorMatches:    errs,
+			NormalizeErrors: tomltest.AllNormalize,
+			SkipTests:       []string{"valid/*/*", "valid/*/*/*"},
+			Decoder: tomltest.FuncParser{Decode: func(ctx context.Context, data []byte) (any, error) {
+				var v any
+				_, err := toml.Decode(string(data), &v)
+				// Different error for different versions.
+				if inv, _ := tomltest.InvocationFromContext(ctx); err != nil && strings.Contains(inv.Name, "/string/") {
+					err = fmt.Errorf("%s: %w", inv.Version, err)
+				}
+				return v, err
+			}},
+		})
+	}
+	run := func(t *testing.T, versions []string, errs map[string][]tomltest.ErrorMatch) ([]tomltest.Runner, []tomltest.Tests) {
+		t.Helper()
+		runners := make([]tomltest.Runner, 0, len(versions))
+		results := make([]tomltest.Tests, 0, len(versions))
+		for _, v := range versions {
+			r := newRunner(v, errs)
+			tests, err := r.Run()
+			if err != nil {
+				t.Fatalf("%s: %s", v, err)
+			}
+			runners, results = append(runners, r), append(results, tests)
+		}
+		return runners, results
+	}
+	failed := func(tests tomltest.Tests) []string {
+		var f []string
+		for _, t := range tests.Tests {
+			if t.Failed() {
+				f = append(f, t.Path)
+			}
+		}
+		return f
+	}
+
+	file := filepath.Join(t.TempDir(), "errors.toml")
+	all := tomltest.Versions()
+	runners, results := run(t, all, nil)
+	if n, err := updateErrors(file, runners, results); err != nil || n == 0 {
+		t.Fatalf("n=%d; err=%v", n, err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, err := tomltest.ParseErrors(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range all {
+		t.Run(v, func(t *testing.T) {
+			_, have := run(t, []string{v}, errs)
+			h, w := failed(have[0]), failed(results[i])
+			if strings.Join(h, " ") != strings.Join(w, " ") {
+				t.Errorf("\nhave: %s\nwant: %s", h, w)
+			}
+		})
+	}
+}
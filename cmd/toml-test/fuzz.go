@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	tomltest "github.com/toml-lang/toml-test/v2"
+	"zgo.at/jfmt"
+	"zgo.at/zli"
+)
+
+func cmdFuzz(f zli.Flags) {
+	var (
+		decoder     = f.String("", "decoder")
+		decoderMode = f.String("exec", "decoder-mode")
+		tomlVersion = f.String(tomltest.DefaultVersion, "toml")
+		seed        = f.Int(0, "seed")
+		n           = f.Int(1000, "n")
+		maxDepth    = f.Int(4, "max-depth")
+		maxKeys     = f.Int(6, "max-keys")
+		save        = f.String("toml-test-fuzz", "save")
+		printDoc    = f.Bool(false, "print")
+		invalid     = f.Bool(false, "invalid")
+		skip        = f.StringList(nil, "skip")
+		run         = f.StringList(nil, "run")
+		parallel    = f.Int(runtime.NumCPU(), "parallel")
+		timeout     = f.String("1s", "timeout")
+		verbose     = f.Bool(false, "v")
+		validity    = f.String("stderr", "validity")
+		rejectCodes = f.StringList(nil, "reject-exit-codes")
+		env         = f.StringList(nil, "env")
+		shell       = f.Bool(false, "shell")
+	)
+	zli.F(f.Parse())
+	if len(f.Args) > 0 {
+		zli.Fatalf("no positional arguments allowed")
+	}
+	if !seed.Set() {
+		*seed.Pointer() = int(time.Now().UnixNano() % 1e9)
+	}
+	dur, err := time.ParseDuration(timeout.String())
+	zli.F(err)
+
+	runner := tomltest.NewRunner(tomltest.Runner{
+		Version:         tomlVersion.String(),
+		Timeout:         dur,
+		RunTests:        run.StringsSplit(","),
+		SkipTests:       skip.StringsSplit(","),
+		Validity:        validity.String(),
+		RejectExitCodes: parseValidity(validity.String(), rejectCodes.StringsSplit(",")),
+		Env:             env.Strings(),
+	})
+	gen := tomltest.Generator{Version: runner.Version, MaxDepth: maxDepth.Int(), MaxKeys: maxKeys.Int()}
+
+	if printDoc.Bool() {
+		if invalid.Bool() {
+			zli.Fatalf("can't use -print with -invalid")
+		}
+		doc, want := gen.Generate(int64(seed.Int()))
+		fmt.Print(doc)
+		fmt.Println("\n# JSON:")
+		fmt.Print(want)
+		return
+	}
+
+	if decoder.String() == "" {
+		zli.Fatalf("must have -decoder command")
+	}
+	runner.Decoder = newParser("-decoder", decoderMode.String(), decoder.String(), parallel.Int(), shell.Bool())
+	defer closeParser(runner.Decoder)
+
+	var docs []tomltest.BenchDoc
+	if invalid.Bool() {
+		docs, err = runner.BenchDocs()
+		zli.F(err)
+		if len(docs) == 0 {
+			zli.Fatalf("no valid tests to mutate")
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var (
+		limit  = make(chan struct{}, parallel.Int())
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		ran    int
+		failed []string
+	)
+	fmt.Printf("toml-test %s; TOML %s; seeds %d to %d\n\n", zli.Version(), runner.Version, seed.Int(), seed.Int()+n.Int()-1)
+	for i := 0; i < n.Int(); i++ {
+		select {
+		case limit <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(s int64) {
+			defer func() { <-limit; wg.Done() }()
+			var (
+				t   tomltest.Test
+				err error
+			)
+			if invalid.Bool() {
+				t, err = runner.FuzzInvalid(ctx, docs, s)
+			} else {
+				t, err = runner.Fuzz(ctx, gen, s)
+			}
+			zli.F(err)
+			if ctx.Err() != nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			ran++
+			if !t.Failed() {
+				if verbose.Bool() {
+					fmt.Print(detailed(runner, t))
+				}
+				return
+			}
+			fmt.Print(detailed(runner, t))
+			if save.String() != "" {
+				zli.F(saveTest(save.String(), t))
+			}
+			failed = append(failed, t.Path)
+		}(int64(seed.Int() + i))
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		fmt.Println(zli.Colorize("interrupted: not all documents were run", hlErr))
+	}
+	fmt.Printf("%d documents, %d failed\n", ran, len(failed))
+	if len(failed) > 0 {
+		if save.String() != "" {
+			fmt.Printf("failing documents written to %s\n", save)
+		}
+		zli.Exit(1)
+	}
+}
+
+// saveTest writes the Input and Want of a test to dir, in the same layout as
+// the tests/ directory.
+func saveTest(dir string, t tomltest.Test) error {
+	p := filepath.Join(dir, filepath.FromSlash(t.Path))
+	err := os.MkdirAll(filepath.Dir(p), 0o777)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p+".toml", []byte(t.Input), 0o644); err != nil {
+		return err
+	}
+	if t.Want == "" {
+		return nil
+	}
+	want, err := jfmt.NewFormatter(80, "", "    ").FormatString(t.Want)
+	if err != nil {
+		want = t.Want
+	}
+	return os.WriteFile(p+".json", []byte(want), 0o644)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tomltest "github.com/toml-lang/toml-test/v2"
+	"zgo.at/zli"
+)
+
+type (
+	junitSuites struct {
+		XMLName  xml.Name     `xml:"testsuites"`
+		Name     string       `xml:"name,attr"`
+		Tests    int          `xml:"tests,attr"`
+		Failures int          `xml:"failures,attr"`
+		Errors   int          `xml:"errors,attr"`
+		Skipped  int          `xml:"skipped,attr"`
+		Time     junitTime    `xml:"time,attr"`
+		Suites   []junitSuite `xml:"testsuite"`
+	}
+	junitSuite struct {
+		Name       string          `xml:"name,attr"`
+		Tests      int             `xml:"tests,attr"`
+		Failures   int             `xml:"failures,attr"`
+		Errors     int             `xml:"errors,attr"`
+		Skipped    int             `xml:"skipped,attr"`
+		Time       junitTime       `xml:"time,attr"`
+		Properties []junitProperty `xml:"properties>property"`
+		Cases      []junitCase     `xml:"testcase"`
+	}
+	junitProperty struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	}
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Time      junitTime     `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure"`
+		Error     *junitFailure `xml:"error"`
+		Skipped   *struct{}     `xml:"skipped"`
+		SystemOut string        `xml:"system-out,omitempty"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+	// junitTime is a duration in seconds.
+	junitTime time.Duration
+)
+
+func (t junitTime) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	return xml.Attr{Name: name, Value: strconv.FormatFloat(time.Duration(t).Seconds(), 'f', 3, 64)}, nil
+}
+
+// printJUnit prints the results as JUnit XML, with a <testsuite> for every
+// test type. Input and output are only added for failed tests, unless verbose
+// is set.
+//
+// Errors from the runner (if any) are added as an <error> in a "runner"
+// testsuite for that version.
+func printJUnit(runners []tomltest.Runner, results []tomltest.Tests, errs []string, verbose int) {
+	out := junitSuites{Name: "toml-test"}
+	add := func(s junitSuite) {
+		out.Tests += s.Tests
+		out.Failures += s.Failures
+		out.Errors += s.Errors
+		out.Skipped += s.Skipped
+		out.Time += s.Time
+		out.Suites = append(out.Suites, s)
+	}
+	for i, r := range runners {
+		for _, typ := range []string{"valid", "encoder", "encoder-invalid", "invalid"} {
+			if s := newJUnitSuite(r, results[i], typ, len(runners) > 1, verbose); len(s.Cases) > 0 {
+				add(s)
+			}
+		}
+		if len(errs) > 0 && errs[i] != "" {
+			s := newJUnitSuite(r, tomltest.Tests{}, "runner", len(runners) > 1, verbose)
+			s.Tests, s.Errors = 1, 1
+			s.Cases = []junitCase{{Name: "runner", Classname: s.Name,
+				Error: &junitFailure{Message: errs[i], Type: "error", Text: errs[i]}}}
+			add(s)
+		}
+	}
+
+	fmt.Print(xml.Header)
+	enc := xml.NewEncoder(os.Stdout)
+	enc.Indent("", "    ")
+	zli.F(enc.Encode(out))
+	fmt.Println()
+}
+
+func newJUnitSuite(r tomltest.Runner, tests tomltest.Tests, typ string, withVersion bool, verbose int) junitSuite {
+	name := typ
+	if withVersion {
+		name = "toml-" + r.Version + "/" + name
+	}
+	enc := ""
+	if r.Encoder != nil {
+		enc = strings.Join(r.Encoder.Cmd(), " ")
+	}
+	s := junitSuite{
+		Name: name,
+		Properties: []junitProperty{
+			{"toml", r.Version},
+			{"decoder", strings.Join(r.Decoder.Cmd(), " ")},
+			{"encoder", enc},
+		},
+	}
+	for _, t := range tests.Tests {
+		if t.Type().String() != typ {
+			continue
+		}
+		c := junitCase{Name: t.Path, Classname: name, Time: junitTime(t.Elapsed)}
+		switch {
+		case t.Skipped:
+			c.Skipped = &struct{}{}
+			s.Skipped++
+		case t.Failed():
+			msg, _, _ := strings.Cut(t.Failure, "\n")
+			c.Failure = &junitFailure{Message: msg, Type: t.Outcome.String(), Text: t.Failure}
+			s.Failures++
+		}
+		if !t.Skipped && (t.Failed() || verbose >= 1) {
+			c.SystemOut = junitOutput(t)
+		}
+		s.Tests++
+		s.Time += c.Time
+		s.Cases = append(s.Cases, c)
+	}
+	return s
+}
+
+// junitOutput gets the input, output, and wanted output for <system-out>.
+func junitOutput(t tomltest.Test) string {
+	want := t.Want
+	if t.Invalid() || t.EncoderInvalid() {
+		codes := make([]string, 0, len(t.RejectExitCodes))
+		for _, c := range t.RejectExitCodes {
+			codes = append(codes, strconv.Itoa(c))
+		}
+		want = "Exit code " + strings.Join(codes, " or ")
+	}
+	stream := "stdout"
+	if t.OutputFromStderr {
+		stream = "stderr"
+	}
+
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "input:\n%s\n\n", strings.TrimRight(t.Input, "\n"))
+	fmt.Fprintf(b, "output (%s; exit %d):\n%s\n\n", stream, t.ExitCode, strings.TrimRight(t.Output, "\n"))
+	if t.Diagnostics != "" {
+		fmt.Fprintf(b, "diagnostics:\n%s\n\n", strings.TrimRight(t.Diagnostics, "\n"))
+	}
+	fmt.Fprintf(b, "want:\n%s\n", strings.TrimRight(want, "\n"))
+	return b.String()
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"io/fs"
+	"path"
 	"sort"
 	"strings"
 
@@ -16,7 +18,11 @@ func cmdList(f zli.Flags) {
 	)
 	zli.F(f.Parse())
 
-	l := getList(tomltest.NewRunner(tomltest.Runner{Version: tomlVersion.String()}))
+	files := getList(tomltest.NewRunner(tomltest.Runner{Version: tomlVersion.String()}))
+	l := make([]string, 0, len(files))
+	for _, ff := range files {
+		l = append(l, ff.name)
+	}
 	if asJSON.Bool() {
 		newEnc().Encode(l)
 	} else {
@@ -26,21 +32,68 @@ func cmdList(f zli.Flags) {
 	}
 }
 
-func getList(r tomltest.Runner) []string {
+// listFile is a single test file.
+type listFile struct {
+	name     string
+	test     tomltest.Test
+	json     bool
+	position bool // Expected error position for invalid tests.
+}
+
+// Read the file contents.
+func (f listFile) read(fsys tomltest.Runner) (string, error) {
+	if f.json {
+		_, d, err := f.test.ReadWant(fsys.Files)
+		return d, err
+	}
+	if f.position {
+		d, err := fs.ReadFile(fsys.Files, f.test.Path+".position")
+		return string(d), err
+	}
+	_, d, err := f.test.ReadInput(fsys.Files)
+	return d, err
+}
+
+// getList gets all test files. Tests from .multi files are listed as if they're
+// a regular file: "invalid/float/float.multi#exp-point-1" is listed as
+// "invalid/float/exp-point-1.toml", and "valid/key/numeric.multi#01" as
+// "valid/key/numeric-01.toml" and "valid/key/numeric-01.json".
+func getList(r tomltest.Runner) []listFile {
 	l, err := r.List()
 	zli.F(err)
 
-	sort.Strings(l)
-	n := make([]string, 0, len(l)*2)
+	n := make([]listFile, 0, len(l)*2)
 	for _, ll := range l {
 		if strings.HasPrefix(ll, "encoder/") {
 			continue
 		}
 
+		name := ll
+		if file, test, ok := strings.Cut(ll, "#"); ok {
+			file = strings.TrimSuffix(file, ".multi")
+			if strings.HasPrefix(ll, "valid/") {
+				name = file + "-" + test
+			} else {
+				name = file[:strings.LastIndexByte(file, '/')+1] + test
+			}
+		}
+
+		t := tomltest.Test{Path: ll}
+		if t.EncoderInvalid() {
+			n = append(n, listFile{name: name + ".json", test: t})
+			continue
+		}
 		if strings.HasPrefix(ll, "valid/") {
-			n = append(n, ll+".json")
+			n = append(n, listFile{name: name + ".json", test: t, json: true})
+		}
+		n = append(n, listFile{name: name + ".toml", test: t})
+		if _, err := fs.Stat(r.Files, ll+".position"); t.Invalid() && err == nil {
+			n = append(n, listFile{name: name + ".position", test: t, position: true})
 		}
-		n = append(n, ll+".toml")
 	}
+	noExt := func(s string) string { return strings.TrimSuffix(s, path.Ext(s)) }
+	sort.SliceStable(n, func(i, j int) bool {
+		return noExt(n[i].name) < noExt(n[j].name)
+	})
 	return n
 }
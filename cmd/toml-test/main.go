@@ -12,7 +12,7 @@ func main() {
 	f := zli.NewFlags(os.Args)
 	helpFlag := f.Bool(false, "h", "help")
 	zli.F(f.Parse(zli.AllowUnknown()))
-	cmd, err := f.ShiftCommand("help", "version", "test", "list", "ls", "copy", "cp")
+	cmd, err := f.ShiftCommand("help", "version", "test", "list", "ls", "copy", "cp", "bench", "diff-impl", "fuzz", "reduce")
 	if errors.Is(err, zli.ErrCommandNoneGiven{}) {
 		fmt.Print(usage)
 		return
@@ -45,5 +45,13 @@ func main() {
 		cmdCopy(f)
 	case "test":
 		cmdTest(f)
+	case "bench":
+		cmdBench(f)
+	case "diff-impl":
+		cmdDiffImpl(f)
+	case "fuzz":
+		cmdFuzz(f)
+	case "reduce":
+		cmdReduce(f)
 	}
 }
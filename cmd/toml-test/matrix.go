@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	tomltest "github.com/toml-lang/toml-test/v2"
+	"zgo.at/zli"
+)
+
+// matrixRow is a single test, with the status for every TOML version.
+type matrixRow struct {
+	Path   string            `json:"path"`
+	Status map[string]string `json:"status"`
+}
+
+// testMatrix runs the tests for more than one TOML version.
+func testMatrix(ctx context.Context, runners []tomltest.Runner, opts testOpts) {
+	var ndjson *json.Encoder
+	if opts.format == "ndjson" {
+		ndjson = json.NewEncoder(os.Stdout)
+		ndjson.SetEscapeHTML(false)
+	}
+
+	var (
+		results = make([]tomltest.Tests, len(runners))
+		errs    = make([]string, len(runners)) // Error from the runner, per version.
+	)
+	for i := range runners {
+		runner := runners[i]
+		if ctx.Err() != nil {
+			results[i].Partial = true
+			continue
+		}
+		if ndjson != nil {
+			runner.OnResult = func(t tomltest.Test) {
+				ndjson.Encode(struct {
+					Event string `json:"event"`
+					TOML  string `json:"toml"`
+					tomltest.Test
+				}{"test", runner.Version, t})
+			}
+		}
+
+		tests, err := runner.RunContext(ctx)
+		closeParser(runner.Decoder)
+		closeParser(runner.Encoder)
+		if err != nil {
+			errs[i] = err.Error()
+		}
+		results[i] = tests
+
+		if ndjson != nil {
+			ndjson.Encode(struct {
+				Event string `json:"event"`
+				summary
+				Error string `json:"error,omitempty"`
+			}{"summary", newSummary(runner, tests), errs[i]})
+		}
+	}
+
+	switch opts.format {
+	case "json":
+		printMatrixJSON(runners, results, errs, opts.verbose)
+	case "junit":
+		printJUnit(runners, results, errs, opts.verbose)
+	case "ndjson":
+	default:
+		printMatrixText(runners, results, errs, opts.verbose)
+	}
+
+	for i := range runners {
+		if errs[i] != "" {
+			if opts.errors != "" {
+				fmt.Fprintf(os.Stderr, "errors for TOML %s; not writing %s\n", runners[i].Version, opts.errors)
+			}
+			zli.Exit(1)
+		}
+	}
+	writeErrors(opts.errors, runners, results)
+
+	for _, tests := range results {
+		if tests.Partial || tests.FailedValid > 0 || tests.FailedEncoder > 0 || tests.FailedEncoderInvalid > 0 || tests.FailedInvalid > 0 {
+			zli.Exit(1)
+		}
+	}
+	zli.Exit(0)
+}
+
+// matrixRows gets one row for every test in any of the versions. Only rows
+// where the test failed in at least one version are returned unless all is
+// set.
+func matrixRows(runners []tomltest.Runner, results []tomltest.Tests, all bool) []matrixRow {
+	var (
+		rows   = make(map[string]matrixRow)
+		failed = make(map[string]struct{})
+	)
+	for i, tests := range results {
+		for _, t := range tests.Tests {
+			row, ok := rows[t.Path]
+			if !ok {
+				row = matrixRow{Path: t.Path, Status: make(map[string]string, len(runners))}
+				rows[t.Path] = row
+			}
+			row.Status[runners[i].Version] = t.Outcome.String()
+			if t.Failed() {
+				failed[t.Path] = struct{}{}
+			}
+		}
+	}
+
+	list := make([]matrixRow, 0, len(rows))
+	for _, r := range rows {
+		if _, ok := failed[r.Path]; ok || all {
+			list = append(list, r)
+		}
+	}
+
+	// Sort valid first, then encoder, encoder-invalid, and invalid last, like
+	// the Runner.
+	tr := strings.NewReplacer("encoder-invalid/", "xencoder-invalid/", "encoder/", "wencoder/", "invalid/", "zinvalid/")
+	sort.Slice(list, func(i, j int) bool {
+		return tr.Replace(list[i].Path) < tr.Replace(list[j].Path)
+	})
+	return list
+}
+
+func printMatrixJSON(runners []tomltest.Runner, results []tomltest.Tests, errs []string, verbose int) {
+	type report struct {
+		summary
+		Error string          `json:"error,omitempty"`
+		Tests []tomltest.Test `json:"tests"`
+	}
+	out := struct {
+		Version  string            `json:"version"`
+		Flags    []string          `json:"flags"`
+		Versions map[string]report `json:"versions"`
+		Tests    []matrixRow       `json:"tests"`
+	}{
+		Version:  fmt.Sprintf("toml-test %s", zli.Version()),
+		Flags:    os.Args,
+		Versions: make(map[string]report, len(runners)),
+		Tests:    matrixRows(runners, results, verbose >= 1),
+	}
+	for i, r := range runners {
+		rep := report{newSummary(r, results[i]), errs[i], []tomltest.Test{}}
+		for _, t := range results[i].Tests {
+			if t.Failed() || verbose >= 1 {
+				rep.Tests = append(rep.Tests, t)
+			}
+		}
+		out.Versions[r.Version] = rep
+	}
+	newEnc().Encode(out)
+}
+
+func printMatrixText(runners []tomltest.Runner, results []tomltest.Tests, errs []string, verbose int) {
+	for i, r := range runners {
+		header := false
+		for _, t := range results[i].Tests {
+			if !t.Failed() && verbose <= 1 {
+				continue
+			}
+			if !header {
+				fmt.Println(zli.Colorize("TOML "+r.Version, zli.Bold))
+				fmt.Println()
+				header = true
+			}
+			fmt.Print(detailed(r, t))
+		}
+	}
+
+	// Tests with the status for every version.
+	if rows := matrixRows(runners, results, verbose >= 1); len(rows) > 0 {
+		for _, r := range runners {
+			fmt.Printf("%-7s ", r.Version)
+		}
+		fmt.Println()
+		for _, row := range rows {
+			for _, r := range runners {
+				st, ok := row.Status[r.Version]
+				switch {
+				case !ok:
+					fmt.Printf("%-7s ", "-")
+				case st == tomltest.OutcomePassed.String():
+					fmt.Printf("%-7s ", "PASS")
+				case st == tomltest.OutcomeSkipped.String():
+					fmt.Printf("%-7s ", "SKIP")
+				default:
+					fmt.Print(zli.Colorize("FAIL", hlErr), "    ")
+				}
+			}
+			fmt.Println(row.Path)
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("toml-test %s\n", zli.Version())
+	for _, r := range runners {
+		enc := "[no encoder]"
+		if r.Encoder != nil {
+			enc = fmt.Sprintf("%s", r.Encoder.Cmd())
+		}
+		fmt.Printf("  TOML %s: %s %s\n", r.Version, r.Decoder.Cmd(), enc)
+	}
+	for i, r := range runners {
+		if results[i].Partial {
+			fmt.Println(zli.Colorize("interrupted: not all tests were run for TOML "+r.Version, hlErr))
+		}
+		if errs[i] != "" {
+			fmt.Println(zli.Colorize("error for TOML "+r.Version+": "+errs[i], hlErr))
+		}
+	}
+
+	fmt.Printf("%-15s", "")
+	for _, r := range runners {
+		fmt.Printf("  %-24s", "TOML "+r.Version)
+	}
+	fmt.Println()
+	row := func(name string, cell func(r tomltest.Runner, t tomltest.Tests) string) {
+		fmt.Printf("%15s", name+":")
+		for i, tests := range results {
+			fmt.Printf("  %-24s", cell(runners[i], tests))
+		}
+		fmt.Println()
+	}
+	counts := func(passed, failed int) string { return fmt.Sprintf("%3d passed, %2d failed", passed, failed) }
+
+	var (
+		skipped, crashed, timedOut, wrongPos int
+		hasErr                               bool
+	)
+	for i, tests := range results {
+		hasErr = hasErr || errs[i] != ""
+		skipped += tests.Skipped
+		crashed += tests.Crashed
+		timedOut += tests.TimedOut
+		wrongPos += tests.WrongPosition
+	}
+	if skipped > 0 {
+		row("skipped tests", func(_ tomltest.Runner, t tomltest.Tests) string { return fmt.Sprintf("%3d", t.Skipped) })
+	}
+	row("valid tests", func(_ tomltest.Runner, t tomltest.Tests) string { return counts(t.PassedValid, t.FailedValid) })
+	row("encoder tests", func(r tomltest.Runner, t tomltest.Tests) string {
+		if r.Encoder == nil {
+			return "no encoder command"
+		}
+		return counts(t.PassedEncoder, t.FailedEncoder)
+	})
+	row("enc. invalid", func(r tomltest.Runner, t tomltest.Tests) string {
+		if r.Encoder == nil {
+			return "no encoder command"
+		}
+		return counts(t.PassedEncoderInvalid, t.FailedEncoderInvalid)
+	})
+	row("invalid tests", func(_ tomltest.Runner, t tomltest.Tests) string { return counts(t.PassedInvalid, t.FailedInvalid) })
+	if crashed > 0 || timedOut > 0 {
+		row("parser errors", func(_ tomltest.Runner, t tomltest.Tests) string {
+			return fmt.Sprintf("%3d crashed, %d timed out", t.Crashed, t.TimedOut)
+		})
+	}
+	if hasErr {
+		byVersion := make(map[string]string, len(runners))
+		for i, r := range runners {
+			byVersion[r.Version] = errs[i]
+		}
+		row("runner error", func(r tomltest.Runner, _ tomltest.Tests) string {
+			if byVersion[r.Version] == "" {
+				return "-"
+			}
+			return zli.Colorize(fmt.Sprintf("%-24s", "error (see above)"), hlErr)
+		})
+	}
+	if wrongPos > 0 {
+		row("err. position", func(_ tomltest.Runner, t tomltest.Tests) string {
+			return fmt.Sprintf("%3d wrong or missing", t.WrongPosition)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"time"
+
+	tomltest "github.com/toml-lang/toml-test/v2"
+	"zgo.at/zli"
+)
+
+func cmdReduce(f zli.Flags) {
+	var (
+		decoder     = f.String("", "decoder")
+		decoderMode = f.String("exec", "decoder-mode")
+		tomlVersion = f.String(tomltest.DefaultVersion, "toml")
+		run         = f.String("", "run")
+		timeout     = f.String("1s", "timeout")
+		intAsFloat  = f.Bool(false, "int-as-float")
+		validity    = f.String("stderr", "validity")
+		rejectCodes = f.StringList(nil, "reject-exit-codes")
+		env         = f.StringList(nil, "env")
+		shell       = f.Bool(false, "shell")
+	)
+	zli.F(f.Parse())
+	if len(f.Args) > 0 {
+		zli.Fatalf("no positional arguments allowed")
+	}
+	if decoder.String() == "" {
+		zli.Fatalf("must have -decoder command")
+	}
+	if run.String() == "" {
+		zli.Fatalf("must have -run with the test to reduce")
+	}
+	dur, err := time.ParseDuration(timeout.String())
+	zli.F(err)
+
+	runner := tomltest.NewRunner(tomltest.Runner{
+		Version:         tomlVersion.String(),
+		Timeout:         dur,
+		IntAsFloat:      intAsFloat.Bool(),
+		Validity:        validity.String(),
+		RejectExitCodes: parseValidity(validity.String(), rejectCodes.StringsSplit(",")),
+		Env:             env.Strings(),
+	})
+
+	// Allow globs, as long as it matches one test.
+	list, err := runner.List()
+	zli.F(err)
+	var match []string
+	for _, l := range list {
+		if m, _ := path.Match(run.String(), l); m {
+			match = append(match, l)
+		}
+	}
+	switch len(match) {
+	case 0:
+		zli.Fatalf("-run %q doesn't match any test", run)
+	case 1:
+	default:
+		zli.Fatalf("-run %q matches %d tests; must match exactly one", run, len(match))
+	}
+
+	runner.Decoder = newParser("-decoder", decoderMode.String(), decoder.String(), 1, shell.Bool())
+	defer closeParser(runner.Decoder)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	orig, reduced, err := runner.Reduce(ctx, match[0])
+	if errors.Is(err, context.Canceled) {
+		zli.Fatalf("interrupted")
+	}
+	zli.F(err)
+
+	if !orig.Failed() {
+		fmt.Printf("%s passed; nothing to reduce\n", orig.Path)
+		return
+	}
+	fmt.Print(detailed(runner, reduced))
+	fmt.Printf("Reduced %s from %d to %d bytes.\n", orig.Path, len(orig.Input), len(reduced.Input))
+
+	fmt.Printf("\n%s\n", zli.Colorize("Input:", zli.Bold))
+	fmt.Println(strings.TrimRight(reduced.Input, "\n"))
+	if reduced.Want != "" {
+		fmt.Printf("\n%s\n", zli.Colorize("Expected JSON:", zli.Bold))
+		fmt.Println(strings.TrimRight(reduced.Want, "\n"))
+	}
+}
@@ -1,18 +1,22 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	tomltest "github.com/toml-lang/toml-test/v2"
 	"zgo.at/jfmt"
 	"zgo.at/zli"
@@ -23,41 +27,84 @@ var hlErr = zli.Color256(224).Bg() | zli.Color256(0) | zli.Bold
 //go:embed script.gotxt
 var script []byte
 
-func shellQuote(s string) string {
-	if strings.Contains(s, "'") {
-		s = strings.ReplaceAll(s, `'`, `'"'"'`) // cmd'foo → 'cmd'"'"'foo'
-	}
-	return "'" + s + "'"
-}
-
 var scriptTemplate = template.Must(template.New("").
 	Option("missingkey=error").
-	Funcs(template.FuncMap{"join": strings.Join, "quote": shellQuote}).
+	Funcs(template.FuncMap{"join": strings.Join, "quote": tomltest.ShellQuote}).
 	Parse(string(script)))
 
+// testOpts are the flags for "toml-test test" that aren't set on the Runner.
+type testOpts struct {
+	verbose int
+	script  bool
+	format  string
+	setup   []string
+	shell   bool
+	decoder string // -decoder and -encoder as given on the commandline.
+	encoder string
+	errors  string // Write the errors to this file if -update-errors is set.
+}
+
 func cmdTest(f zli.Flags) {
-	runner, verbose, script, asJSON, setup := parseTestFlags(f)
+	runners, opts := parseTestFlags(f)
+	verbose, format := opts.verbose, opts.format
 
-	for _, s := range setup {
-		f := strings.Fields(s)
+	for _, s := range opts.setup {
 		if verbose > 0 {
 			fmt.Printf("SETUP %v\n", s)
 		}
-		out, err := exec.Command(f[0], f[1:]...).CombinedOutput()
+		var cmd *exec.Cmd
+		if opts.shell {
+			cmd = exec.Command("sh", "-c", s)
+		} else {
+			f, err := tomltest.SplitCommand(s)
+			if err != nil || len(f) == 0 {
+				zli.Fatalf("invalid -setup=%q: %v", s, err)
+			}
+			cmd = exec.Command(f[0], f[1:]...)
+		}
+		out, err := cmd.CombinedOutput()
 		if err != nil {
 			zli.Fatalf("error running -setup=%q: %s: command output:\n%s", s, err, out)
 		}
 	}
 
-	tests, err := runner.Run()
+	// Stop on the first ^C and print the results for the tests that already
+	// finished; a second ^C exits right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() { <-ctx.Done(); stop() }()
+
+	if len(runners) > 1 {
+		testMatrix(ctx, runners, opts)
+		return
+	}
+	runner := runners[0]
+
+	var ndjson *json.Encoder
+	if format == "ndjson" {
+		ndjson = json.NewEncoder(os.Stdout)
+		ndjson.SetEscapeHTML(false)
+		runner.OnResult = func(t tomltest.Test) {
+			ndjson.Encode(struct {
+				Event string `json:"event"`
+				tomltest.Test
+			}{"test", t})
+		}
+	}
+
+	tests, err := runner.RunContext(ctx)
+	stop()
+	closeParser(runner.Decoder)
+	closeParser(runner.Encoder)
 	zli.F(err)
 
-	if script {
-		var failedValid, failedEncoder, failedInvalid []string
+	if opts.script {
+		var failedValid, failedEncoder, failedEncoderInvalid, failedInvalid []string
 		for _, f := range tests.Tests {
 			if f.Failed() {
 				if f.Encoder() {
 					failedEncoder = append(failedEncoder, "encoder/"+f.Path[6:])
+				} else if f.EncoderInvalid() {
+					failedEncoderInvalid = append(failedEncoderInvalid, f.Path)
 				} else if f.Invalid() {
 					failedInvalid = append(failedInvalid, f.Path)
 				} else {
@@ -65,41 +112,96 @@ func cmdTest(f zli.Flags) {
 				}
 			}
 		}
-		var enc []string
-		if runner.Encoder != nil {
-			enc = runner.Encoder.Cmd()
-		}
 		v, _, _ := strings.Cut(zli.Version(), "/") // "v2.2.0" or "e4e12cad/2026-04-30"
 		err := scriptTemplate.Execute(os.Stdout, struct {
-			Decoder       []string
-			Encoder       []string
-			Setup         []string
-			TOML          string
-			Version       string
-			FailedValid   []string
-			FailedEncoder []string
-			FailedInvalid []string
-		}{runner.Decoder.Cmd(), enc, setup, runner.Version, v, failedValid, failedEncoder, failedInvalid})
+			Decoder              string
+			Encoder              string
+			Shell                bool
+			Setup                []string
+			TOML                 string
+			Version              string
+			FailedValid          []string
+			FailedEncoder        []string
+			FailedEncoderInvalid []string
+			FailedInvalid        []string
+		}{opts.decoder, opts.encoder, opts.shell, opts.setup, runner.Version, v,
+			failedValid, failedEncoder, failedEncoderInvalid, failedInvalid})
 		zli.F(err)
 		return
 	}
 
-	if asJSON {
+	switch format {
+	case "json":
 		printJSON(runner, tests, verbose)
-	} else {
+	case "junit":
+		printJUnit(runners, []tomltest.Tests{tests}, nil, verbose)
+	case "ndjson":
+		ndjson.Encode(struct {
+			Event string `json:"event"`
+			summary
+		}{"summary", newSummary(runner, tests)})
+	default:
 		printText(runner, tests, verbose)
 	}
+	writeErrors(opts.errors, runners, []tomltest.Tests{tests})
 
-	if tests.FailedValid > 0 || tests.FailedEncoder > 0 || tests.FailedInvalid > 0 {
+	if tests.Partial || tests.FailedValid > 0 || tests.FailedEncoder > 0 || tests.FailedEncoderInvalid > 0 || tests.FailedInvalid > 0 {
 		zli.Exit(1)
 	}
 	zli.Exit(0)
 }
 
-func parseTestFlags(f zli.Flags) (tomltest.Runner, int, bool, bool, []string) {
+// versionFlags removes -decoder@[version] and -encoder@[version] from the
+// arguments.
+func versionFlags(args []string) ([]string, map[string]string, map[string]string) {
+	var (
+		rest = make([]string, 0, len(args))
+		dec  = make(map[string]string)
+		enc  = make(map[string]string)
+	)
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name := strings.TrimLeft(a, "-")
+		if !strings.HasPrefix(a, "-") || !(strings.HasPrefix(name, "decoder@") || strings.HasPrefix(name, "encoder@")) {
+			rest = append(rest, a)
+			continue
+		}
+
+		name, val, ok := strings.Cut(name, "=")
+		if !ok {
+			if i+1 == len(args) {
+				zli.Fatalf("-%s: needs an argument", name)
+			}
+			i++
+			val = args[i]
+		}
+		flag, v, _ := strings.Cut(name, "@")
+		vv, err := tomltest.ParseVersions(v)
+		if err != nil || len(vv) != 1 || v == "all" {
+			zli.Fatalf("-%s: invalid version %q", name, v)
+		}
+		if flag == "decoder" {
+			dec[vv[0]] = val
+		} else {
+			enc[vv[0]] = val
+		}
+	}
+	return rest, dec, enc
+}
+
+func parseTestFlags(f zli.Flags) ([]tomltest.Runner, testOpts) {
+	var decVersion, encVersion map[string]string
+	f.Args, decVersion, encVersion = versionFlags(f.Args)
+
 	var (
 		decoder       = f.String("", "decoder")
 		encoder       = f.String("", "encoder")
+		decoderMode   = f.String("exec", "decoder-mode")
+		encoderMode   = f.String("exec", "encoder-mode")
 		setup         = f.StringList(nil, "setup")
 		tomlVersion   = f.String(tomltest.DefaultVersion, "toml")
 		verbose       = f.IntCounter(0, "v")
@@ -113,67 +215,163 @@ func parseTestFlags(f zli.Flags) (tomltest.Runner, int, bool, bool, []string) {
 		timeout       = f.String("1s", "timeout")
 		skipMustError = f.Bool(false, "skip-must-err", "skip-must-error")
 		asJSON        = f.Bool(false, "json")
+		format        = f.String("text", "format")
+		variants      = f.StringList(nil, "variants")
+		validity      = f.String("stderr", "validity")
+		rejectCodes   = f.StringList(nil, "reject-exit-codes")
+		env           = f.StringList(nil, "env")
+		shell         = f.Bool(false, "shell")
+		roundtrip     = f.Bool(false, "roundtrip")
+		posRegex      = f.StringList(nil, "error-position-regex")
+		posWarn       = f.Bool(false, "error-position-warn")
+		updateErrors  = f.Bool(false, "update-errors")
+		normalize     = f.String("paths,pids,ansi,exit", "normalize-errors")
 	)
 	zli.F(f.Parse())
-	if script.Bool() && asJSON.Bool() {
-		zli.Fatalf("-script does not support -json")
+	if asJSON.Bool() {
+		if format.Set() && format.String() != "json" {
+			zli.Fatalf("can't use -json with -format=%s", format)
+		}
+		*format.Pointer() = "json"
+	}
+	switch format.String() {
+	case "text", "json", "ndjson", "junit":
+	default:
+		zli.Fatalf("invalid value for -format: %q", format)
+	}
+	if script.Bool() && format.String() != "text" {
+		zli.Fatalf("-script does not support -format=%s", format)
+	}
+	versions, err := tomltest.ParseVersions(tomlVersion.String())
+	if err != nil {
+		zli.Fatalf("-toml: %s", err)
+	}
+	if script.Bool() && roundtrip.Bool() {
+		zli.Fatalf("-script does not support -roundtrip")
+	}
+	if script.Bool() && len(versions) > 1 {
+		zli.Fatalf("-script can only be used with a single -toml version")
+	}
+	inVersions := make(map[string]struct{}, len(versions))
+	for _, v := range versions {
+		inVersions[v] = struct{}{}
+	}
+	for _, m := range []map[string]string{decVersion, encVersion} {
+		for v := range m {
+			if _, ok := inVersions[v]; !ok {
+				zli.Fatalf("-decoder@%[1]s or -encoder@%[1]s given, but %[1]s is not in -toml", v)
+			}
+		}
 	}
-	if decoder.String() == "" {
-		zli.Fatalf("must have -decoder command")
+	for _, v := range versions {
+		if decoder.String() == "" && decVersion[v] == "" {
+			zli.Fatalf("must have -decoder or -decoder@%s command", v)
+		}
+	}
+	for _, v := range versions {
+		if roundtrip.Bool() && encoder.String() == "" && encVersion[v] == "" {
+			zli.Fatalf("-roundtrip requires an -encoder or -encoder@%s command", v)
+		}
 	}
+	reject := parseValidity(validity.String(), rejectCodes.StringsSplit(","))
 
 	dur, err := time.ParseDuration(timeout.String())
 	zli.F(err)
+	for _, e := range env.Strings() {
+		if k, _, ok := strings.Cut(e, "="); !ok || k == "" {
+			zli.Fatalf("invalid -env: %q (must be KEY=VAL)", e)
+		}
+	}
+	for _, r := range posRegex.Strings() {
+		re, err := regexp.Compile(r)
+		if err != nil {
+			zli.Fatalf("invalid -error-position-regex: %s", err)
+		}
+		if re.SubexpIndex("line") == -1 {
+			zli.Fatalf("invalid -error-position-regex %q: must have a (?P<line>..) group", r)
+		}
+	}
+
+	var norm []string
+	if n := normalize.String(); n != "" && n != "none" {
+		norm = strings.Split(n, ",")
+		if _, err := tomltest.NormalizeOutput("", 0, norm); err != nil {
+			zli.Fatalf("-normalize-errors: %s", err)
+		}
+	}
+	if updateErrors.Bool() && !errors.Set() {
+		zli.Fatalf("-update-errors requires -errors")
+	}
+	if updateErrors.Bool() && script.Bool() {
+		zli.Fatalf("-script does not support -update-errors")
+	}
 
-	var errs map[string]string
-	if errors.Set() {
-		fp, err := os.Open(errors.String())
+	var errs map[string][]tomltest.ErrorMatch
+	if errors.Set() && !updateErrors.Bool() {
+		data, err := os.ReadFile(errors.String())
 		zli.F(err)
-		func() {
-			defer fp.Close()
-			if strings.HasSuffix(errors.String(), ".json") {
-				err = json.NewDecoder(fp).Decode(&errs)
-			} else {
-				_, err = toml.NewDecoder(fp).Decode(&errs)
-			}
-			zli.F(err)
-		}()
+		errs, err = tomltest.ParseErrors(data, strings.HasSuffix(errors.String(), ".json"))
+		if err != nil {
+			zli.Fatalf("-errors: %s: %s", errors, err)
+		}
 	}
 
 	if len(f.Args) > 0 {
 		zli.Fatalf("no positional arguments allowed")
 	}
 
-	var enc tomltest.Parser
-	if encoder.String() != "" {
-		enc = tomltest.NewCommandParser(strings.Fields(encoder.String()))
-	}
-
-	runner := tomltest.NewRunner(tomltest.Runner{
-		Decoder:       tomltest.NewCommandParser(strings.Fields(decoder.String())),
-		Encoder:       enc,
-		RunTests:      run.StringsSplit(","),
-		SkipTests:     skip.StringsSplit(","),
-		Version:       tomlVersion.String(),
-		Parallel:      parallel.Int(),
-		Timeout:       dur,
-		IntAsFloat:    intAsFloat.Bool(),
-		SkipMustError: skipMustError.Bool(),
-		Errors:        errs,
-	})
-	if intAsFloat.Bool() {
-		runner.SkipTests = append(runner.SkipTests, "valid/integer/long")
+	runners := make([]tomltest.Runner, 0, len(versions))
+	for _, v := range versions {
+		var (
+			decCmd = decoder.String()
+			encCmd = encoder.String()
+		)
+		if d, ok := decVersion[v]; ok {
+			decCmd = d
+		}
+		if e, ok := encVersion[v]; ok {
+			encCmd = e
+		}
+		var enc tomltest.Parser
+		if encCmd != "" {
+			enc = newParser("-encoder", encoderMode.String(), encCmd, parallel.Int(), shell.Bool())
+		}
+		runner := tomltest.NewRunner(tomltest.Runner{
+			Decoder:       newParser("-decoder", decoderMode.String(), decCmd, parallel.Int(), shell.Bool()),
+			Encoder:       enc,
+			RunTests:      run.StringsSplit(","),
+			SkipTests:     skip.StringsSplit(","),
+			Version:       v,
+			Parallel:      parallel.Int(),
+			Timeout:       dur,
+			IntAsFloat:    intAsFloat.Bool(),
+			SkipMustError: skipMustError.Bool(),
+			ErrorMatches:  errs,
+			Variants:      variants.StringsSplit(","),
+			Roundtrip:     roundtrip.Bool(),
+
+			Validity:           validity.String(),
+			RejectExitCodes:    reject,
+			Env:                env.Strings(),
+			ErrorPositionRegex: posRegex.Strings(),
+			ErrorPositionWarn:  posWarn.Bool(),
+			NormalizeErrors:    norm,
+		})
+		if intAsFloat.Bool() {
+			runner.SkipTests = append(runner.SkipTests, "valid/integer/long")
+		}
+		runners = append(runners, runner)
 	}
 
 	// TODO: -run='valid/*' doesn't really work as expected, as it uses filepath
 	// glob matching where '*' doesn't match a '/'
-	for _, runner := range runner.RunTests {
+	for _, runner := range runners[0].RunTests {
 		_, err := filepath.Match(runner, "")
 		if err != nil {
 			zli.Fatalf("invalid glob pattern %q in -run: %s", runner, err)
 		}
 	}
-	for _, runner := range runner.SkipTests {
+	for _, runner := range runners[0].SkipTests {
 		_, err := filepath.Match(runner, "")
 		if err != nil {
 			zli.Fatalf("invalid glob pattern %q in -skip: %s", runner, err)
@@ -196,7 +394,77 @@ func parseTestFlags(f zli.Flags) (tomltest.Runner, int, bool, bool, []string) {
 		}
 	}
 
-	return runner, verbose.Int(), script.Bool(), asJSON.Bool(), setup.Strings()
+	opts := testOpts{
+		verbose: verbose.Int(),
+		script:  script.Bool(),
+		format:  format.String(),
+		setup:   setup.Strings(),
+		shell:   shell.Bool(),
+		decoder: decoder.String(),
+		encoder: encoder.String(),
+	}
+	if updateErrors.Bool() {
+		opts.errors = errors.String()
+	}
+	return runners, opts
+}
+
+// parseValidity checks the -validity flag and parses -reject-exit-codes.
+func parseValidity(validity string, rejectCodes []string) []int {
+	switch validity {
+	case "stderr", "exit-code":
+	default:
+		zli.Fatalf("invalid value for -validity: %q", validity)
+	}
+	reject := make([]int, 0, len(rejectCodes))
+	for _, c := range rejectCodes {
+		n, err := strconv.Atoi(c)
+		if err != nil || n <= 0 || n > 255 {
+			zli.Fatalf("invalid exit code in -reject-exit-codes: %q", c)
+		}
+		reject = append(reject, n)
+	}
+	return reject
+}
+
+// newParser creates the parser for the -decoder or -encoder flag.
+func newParser(flag, mode, cmd string, parallel int, shell bool) tomltest.Parser {
+	args := []string{"sh", "-c", cmd}
+	if !shell {
+		var err error
+		args, err = tomltest.SplitCommand(cmd)
+		if err != nil {
+			zli.Fatalf("invalid %s: %s", flag, err)
+		}
+		if len(args) == 0 {
+			zli.Fatalf("%s is empty", flag)
+		}
+	}
+
+	switch mode {
+	case "exec":
+		if shell {
+			return tomltest.NewShellCommandParser(cmd)
+		}
+		return tomltest.NewCommandParser(args)
+	case "persistent":
+		for _, p := range []string{"{file}", "{version}", "{name}"} {
+			if strings.Contains(cmd, p) {
+				zli.Fatalf("can't use %s in %s with %s-mode=persistent", p, flag, flag)
+			}
+		}
+		return tomltest.NewPersistentParser(args, parallel)
+	default:
+		zli.Fatalf("invalid value for %s-mode: %q", flag, mode)
+		return nil
+	}
+}
+
+// closeParser stops any running processes for persistent parsers.
+func closeParser(p tomltest.Parser) {
+	if c, ok := p.(io.Closer); ok {
+		c.Close()
+	}
 }
 
 func newEnc() *json.Encoder {
@@ -206,33 +474,49 @@ func newEnc() *json.Encoder {
 	return j
 }
 
-func printJSON(runner tomltest.Runner, tests tomltest.Tests, verbose int) {
+// summary of a test run, for the JSON output.
+type summary struct {
+	Version              string   `json:"version"`
+	TOML                 string   `json:"toml"`
+	Flags                []string `json:"flags"`
+	Decoder              []string `json:"decoder"`
+	Encoder              []string `json:"encoder"`
+	Roundtrip            bool     `json:"roundtrip"`
+	PassedValid          int      `json:"passed_valid"`
+	PassedEncoder        int      `json:"passed_encoder"`
+	PassedInvalid        int      `json:"passed_invalid"`
+	FailedValid          int      `json:"failed_valid"`
+	FailedEncoder        int      `json:"failed_encoder"`
+	FailedInvalid        int      `json:"failed_invalid"`
+	PassedEncoderInvalid int      `json:"passed_encoder_invalid"`
+	FailedEncoderInvalid int      `json:"failed_encoder_invalid"`
+	Skipped              int      `json:"skipped"`
+	Crashed              int      `json:"crashed"`
+	TimedOut             int      `json:"timed_out"`
+	WrongPosition        int      `json:"wrong_position"`
+	Partial              bool     `json:"partial"`
+}
+
+func newSummary(runner tomltest.Runner, tests tomltest.Tests) summary {
 	var enc []string
 	if runner.Encoder != nil {
 		enc = runner.Encoder.Cmd()
 	}
-
-	out := struct {
-		Version       string          `json:"version"`
-		TOML          string          `json:"toml"`
-		Flags         []string        `json:"flags"`
-		Decoder       []string        `json:"decoder"`
-		Encoder       []string        `json:"encoder"`
-		PassedValid   int             `json:"passed_valid"`
-		PassedEncoder int             `json:"passed_encoder"`
-		PassedInvalid int             `json:"passed_invalid"`
-		FailedValid   int             `json:"failed_valid"`
-		FailedEncoder int             `json:"failed_encoder"`
-		FailedInvalid int             `json:"failed_invalid"`
-		Skipped       int             `json:"skipped"`
-		Tests         []tomltest.Test `json:"tests"`
-	}{
+	return summary{
 		fmt.Sprintf("toml-test %s", zli.Version()),
-		runner.Version, os.Args, runner.Decoder.Cmd(), enc,
+		runner.Version, os.Args, runner.Decoder.Cmd(), enc, runner.Roundtrip,
 		tests.PassedValid, tests.PassedEncoder, tests.PassedInvalid,
 		tests.FailedValid, tests.FailedEncoder, tests.FailedInvalid,
-		tests.Skipped, []tomltest.Test{},
+		tests.PassedEncoderInvalid, tests.FailedEncoderInvalid,
+		tests.Skipped, tests.Crashed, tests.TimedOut, tests.WrongPosition, tests.Partial,
 	}
+}
+
+func printJSON(runner tomltest.Runner, tests tomltest.Tests, verbose int) {
+	out := struct {
+		summary
+		Tests []tomltest.Test `json:"tests"`
+	}{newSummary(runner, tests), []tomltest.Test{}}
 	for _, t := range tests.Tests {
 		if t.Failed() || verbose >= 1 {
 			out.Tests = append(out.Tests, t)
@@ -245,7 +529,7 @@ func printText(runner tomltest.Runner, tests tomltest.Tests, verbose int) {
 	for _, t := range tests.Tests {
 		if t.Failed() || verbose > 1 {
 			fmt.Print(detailed(runner, t))
-		} else if verbose == 1 {
+		} else if verbose == 1 || len(t.Warnings) > 0 {
 			fmt.Print(short(runner, t))
 		}
 	}
@@ -255,16 +539,34 @@ func printText(runner tomltest.Runner, tests tomltest.Tests, verbose int) {
 		enc = fmt.Sprintf("%s", runner.Encoder.Cmd())
 	}
 	fmt.Printf("toml-test %s %s %s\n", zli.Version(), runner.Decoder.Cmd(), enc)
+	if tests.Partial {
+		fmt.Println(zli.Colorize("interrupted: not all tests were run", hlErr))
+	}
 	if tests.Skipped > 0 {
 		fmt.Printf("skipped tests: %d\n", tests.Skipped)
 	}
-	fmt.Printf("  valid tests: %3d passed, %2d failed\n", tests.PassedValid, tests.FailedValid)
+	fmt.Printf("  valid tests: %3d passed, %2d failed", tests.PassedValid, tests.FailedValid)
+	if runner.Roundtrip {
+		fmt.Print(" (round-trip)")
+	}
+	fmt.Println()
 	if runner.Encoder == nil {
 		fmt.Println("encoder tests: no encoder command given")
 	} else {
 		fmt.Printf("encoder tests: %3d passed, %2d failed\n", tests.PassedEncoder, tests.FailedEncoder)
+		fmt.Printf(" enc. invalid: %3d passed, %2d failed\n", tests.PassedEncoderInvalid, tests.FailedEncoderInvalid)
 	}
 	fmt.Printf("invalid tests: %3d passed, %2d failed\n", tests.PassedInvalid, tests.FailedInvalid)
+	if tests.Crashed > 0 || tests.TimedOut > 0 {
+		fmt.Printf("parser errors: %3d crashed, %2d timed out\n", tests.Crashed, tests.TimedOut)
+	}
+	if tests.WrongPosition > 0 {
+		fmt.Printf("err. position: %3d wrong or missing", tests.WrongPosition)
+		if runner.ErrorPositionWarn {
+			fmt.Print(" (warning)")
+		}
+		fmt.Println()
+	}
 }
 
 func short(r tomltest.Runner, t tomltest.Test) string {
@@ -277,21 +579,37 @@ func short(r tomltest.Runner, t tomltest.Test) string {
 		b.WriteString(zli.Bold.String())
 		b.WriteString(t.Path)
 		b.WriteString(zli.Reset.String())
-		if t.Encoder() {
+		if t.Encoder() || t.EncoderInvalid() {
 			b.WriteString(" (encoder)")
 		}
+		if t.Stage != "" {
+			fmt.Fprintf(b, " (round-trip: %s)", t.Stage)
+		}
+		switch t.Outcome {
+		case tomltest.OutcomeRejected, tomltest.OutcomeCrashed, tomltest.OutcomeTimedOut, tomltest.OutcomeWrongPosition:
+			fmt.Fprintf(b, " (%s)", t.Outcome)
+		}
 	case t.Skipped:
 		b.WriteString(hlErr.String())
 		b.WriteString("SKIP")
 		b.WriteString(zli.Reset.String())
 		b.WriteByte(' ')
 		b.WriteString(t.Path)
+	case len(t.Warnings) > 0:
+		b.WriteString("WARN ")
+		b.WriteString(t.Path)
 	default:
 		b.WriteString("PASS ")
 		b.WriteString(t.Path)
 	}
 
 	b.WriteByte('\n')
+	if !t.Failed() {
+		for _, w := range t.Warnings {
+			b.WriteString(indent(w, 5, false))
+			b.WriteByte('\n')
+		}
+	}
 	return b.String()
 }
 
@@ -305,6 +623,9 @@ func detailed(r tomltest.Runner, t tomltest.Test) string {
 			zli.Colorize(" ", hlErr)))
 		b.WriteByte('\n')
 	}
+	if t.Failed() && len(t.Warnings) > 0 {
+		showStream(b, "warnings", strings.Join(t.Warnings, "\n"))
+	}
 	showStream(b, fmt.Sprintf("input sent to parser-cmd (PID %d)", t.PID), t.Input)
 
 	out, err := jfmt.NewFormatter(0, "", "  ").FormatString(t.Output)
@@ -312,13 +633,21 @@ func detailed(r tomltest.Runner, t tomltest.Test) string {
 		t.Output = out
 	}
 
+	stream := "stdout"
 	if t.OutputFromStderr {
-		showStream(b, fmt.Sprintf("output from parser-cmd (PID %d) (stderr)", t.PID), t.Output)
-	} else {
-		showStream(b, fmt.Sprintf("output from parser-cmd (PID %d) (stdout)", t.PID), t.Output)
+		stream = "stderr"
+	}
+	showStream(b, fmt.Sprintf("output from parser-cmd (PID %d) (%s; exit %d; %s)",
+		t.PID, stream, t.ExitCode, t.Duration.Round(time.Microsecond)), t.Output)
+	if t.Diagnostics != "" {
+		showStream(b, "diagnostics from parser-cmd (stderr)", t.Diagnostics)
 	}
-	if t.Invalid() {
-		showStream(b, "want", "Exit code 1")
+	if t.Invalid() || t.EncoderInvalid() {
+		codes := make([]string, 0, len(t.RejectExitCodes))
+		for _, c := range t.RejectExitCodes {
+			codes = append(codes, strconv.Itoa(c))
+		}
+		showStream(b, "want", "Exit code "+strings.Join(codes, " or "))
 	} else {
 		showStream(b, "want", t.Want)
 	}
@@ -3,13 +3,17 @@ package main
 import "strings"
 
 var helpTopics = map[string]string{
-	"":        usage,
-	"test":    usageTest,
-	"list":    usageList,
-	"ls":      usageList,
-	"copy":    usageCopy,
-	"cp":      usageCopy,
-	"version": usageVersion,
+	"":          usage,
+	"test":      usageTest,
+	"bench":     usageBench,
+	"diff-impl": usageDiffImpl,
+	"fuzz":      usageFuzz,
+	"reduce":    usageReduce,
+	"list":      usageList,
+	"ls":        usageList,
+	"copy":      usageCopy,
+	"cp":        usageCopy,
+	"version":   usageVersion,
 }
 
 var usage = `
@@ -23,6 +27,10 @@ Commands:
 
     help      Show help and exit.
     test      Run tests. See "help test" for details.
+    bench     Benchmark decoders and encoders. See "help bench" for details.
+    diff-impl Compare several decoders. See "help diff-impl" for details.
+    fuzz      Test a decoder with random documents. See "help fuzz".
+    reduce    Find the smallest input for a failing test. See "help reduce".
     copy      Write all test files to disk.
     list      List test filenames.
     version   Show version and exit.
@@ -36,11 +44,15 @@ command, which reads TOML from stdin and then outputs JSON describing that TOML
 (or returns an error if it thinks the TOML isn't valid). Encoder tests work the
 same except in reverse: it reads JSON and transforms that to TOML.
 
-There are three types of tests:
+There are four types of tests:
 
-    valid      Valid TOML that the decoder command should describe as JSON.
-    invalid    Invalid TOML files that should be rejected with an error.
-    encoder    JSON that the encoder command should transform to TOML.
+    valid            Valid TOML that the decoder command should describe as
+                     JSON.
+    invalid          Invalid TOML files that should be rejected with an
+                     error.
+    encoder          JSON that the encoder command should transform to TOML.
+    encoder-invalid  Invalid JSON descriptions that the encoder command
+                     should reject with an error.
 
 \x1b[1mImplementing a decoder:\x1b[0m
 
@@ -77,6 +89,34 @@ There are three types of tests:
         print_as_toml(json_description)
         exit(0)
 
+    The output must only use syntax from the -toml version: TOML 1.0 output
+    with \e or \xHH escapes, newlines or trailing commas in inline tables, or
+    times without seconds fails. Output that is valid but ambiguous, such as
+    datetimes with a space or lower-case "t" or "z", is shown as a warning.
+
+    If the JSON description is invalid (for example an integer with the value
+    "abc", an unknown type, or a datetime without an offset), it must exit
+    with code 1, the same as a decoder.
+
+\x1b[1mPersistent mode:\x1b[0m
+
+    Starting a new process for every test can be slow for some languages. With
+    -decoder-mode=persistent or -encoder-mode=persistent the command is started
+    once and reads all tests from stdin. Every message is a header line
+    followed by exactly that many bytes of data:
+
+        Sent to the command:     «length»\n«data»
+        Written by the command:  ok «length»\n«data»
+                                 error «length»\n«data»
+
+    The length is the number of bytes in data as a decimal number. Use "ok"
+    with the JSON (decoder) or TOML (encoder) output, or "error" with an error
+    message if the input is rejected. The command should exit once stdin is
+    closed.
+
+    The command is restarted if it crashes or times out. Up to -parallel
+    commands are run at the same time.
+
 \x1b[1mJSON description\x1b[0m
 
     TOML is described with JSON as follows:
@@ -135,13 +175,69 @@ There are three types of tests:
                    specified in the toml-test README. May be omitted if writing
                    TOML isn't supported.
 
+                   The command is split in arguments like a POSIX shell does,
+                   so you can use quotes: -decoder='my-decoder --opt "a b"'.
+                   Variables, globs, pipes, etc. are not supported; use -shell
+                   for that.
+
+                   These placeholders are replaced in the command:
+
+                       {file}      Path to a temporary file with the input;
+                                   nothing is sent on stdin if this is used.
+                       {version}   TOML version: 1.0.0 or 1.1.0.
+                       {name}      Test name, e.g. valid/string/basic.
+
+                   For example: -decoder='mytool check {file}'.
+
+    -shell         Run -decoder, -encoder, and -setup with "sh -c", so that
+                   pipes, variables, etc. can be used. Placeholders are quoted.
+
+    -decoder-mode  How to run the decoder and encoder commands:
+    -encoder-mode
+                       exec         Start a new process for every test.
+                                    This is the default.
+                       persistent   Start the command once and send it all
+                                    tests over stdin; see "Persistent mode"
+                                    below.
+
+    -validity      How to decide if the decoder or encoder rejected the input:
+
+                       stderr       Rejected if anything is written to
+                                    stderr and it exits with one of
+                                    -reject-exit-codes. This is the
+                                    default.
+                       exit-code    Rejected only if it exits with one of
+                                    -reject-exit-codes; stdout is always
+                                    used on success, and stderr is shown as
+                                    "diagnostics". Useful if the decoder
+                                    writes warnings to stderr.
+
+                   Any other non-zero exit code is reported as a crash.
+
+    -reject-exit-codes
+                   Comma-separated list of exit codes that mean the input was
+                   rejected. Defaults to 1.
+
+    -env           Extra environment variable for the decoder and encoder as
+                   KEY=VAL. Can be added more than once.
+
+                   These environment variables are always set:
+
+                       TOML_TEST_VERSION   TOML version: 1.0.0 or 1.1.0.
+                       TOML_TEST_NAME      Test name, e.g. valid/string/basic.
+                       TOML_TEST_TYPE      valid, invalid, encoder, or
+                                           encoder-invalid.
+
+                   With -decoder-mode=persistent the command is started only
+                   once, so TOML_TEST_NAME and TOML_TEST_TYPE aren't set.
+
     -setup         Run once before any tests, to setup/compile the decoder.
                    toml-test exits with an error and won't run any tests if
                    this exits with non-zero code. Like -decoder and -encoder,
-                   this isn't run through a shell but arguments are split on
-                   whitespace. This flag can be added more than once to run
-                   several commands (which are run in the order they are given
-                   on the commandline).
+                   this isn't run through a shell (unless -shell is used) but
+                   arguments are split with shell quoting rules. This flag can
+                   be added more than once to run several commands (which are
+                   run in the order they are given on the commandline).
 
                    For example:
 
@@ -151,7 +247,20 @@ There are three types of tests:
                         -decoder=./toml-test-decoder \
                         -encoder=./toml-test-encoder
 
-    -json          Output report as JSON rather than text.
+    -format        Output format:
+
+                       text     Human-readable text; the default.
+                       json     JSON report once all tests are finished.
+                       ndjson   One JSON object per line for every test as
+                                soon as it's finished, and a summary once
+                                all tests are finished. Every object has an
+                                "event" key set to "test" or "summary".
+                       junit    JUnit XML report once all tests are
+                                finished, with a <testsuite> for every test
+                                type. The input and output are added for
+                                failed tests, or all tests with -v.
+
+    -json          Same as -format=json.
 
     -script        Print a small bash/zsh script with -skip flag for failing
                    tests; useful to get a list of "known failures" for CI
@@ -159,6 +268,22 @@ There are three types of tests:
 
     -toml          TOML version to run tests for, 1.0 or 1.1. Default is 1.0.
 
+                   Use a comma-separated list or "all" to run the tests for
+                   several versions in one invocation; the output will show
+                   the results for every version side-by-side, and the exit
+                   code is 1 if any version has failures. For example:
+
+                       % toml-test test -decoder=[..] -toml=1.0,1.1
+
+                   Use -decoder@VERSION and -encoder@VERSION to use a
+                   different command for a specific version:
+
+                       % toml-test test -toml=all \
+                           -decoder=./decoder \
+                           -decoder@1.1='./decoder -v1.1'
+
+                   -script can't be used with more than one version.
+
     -timeout       Maximum time for a single test run, to detect infinite loops
                    or pathological cases. Defaults to "1s".
 
@@ -201,6 +326,30 @@ There are three types of tests:
                    float range (it still tests the boundary of safe float64
                    natural numbers).
 
+    -variants      Also run all valid and invalid tests with modified input.
+                   This is a comma-separated list of:
+
+                       crlf       Replace all \n with \r\n.
+                       no-eol     Remove the final newline.
+                       comments   Append "# comment" to every line.
+                       bom        Prepend a UTF-8 byte order mark.
+
+                   Every variant is added as a separate test, with the variant
+                   name appended to the test name (e.g.
+                   "valid/string/basic@crlf"). Variants that don't apply to a
+                   test are skipped, such as comments inside multi-line strings
+                   or invalid tests that become valid without the final
+                   newline.
+
+    -roundtrip     Run valid tests as a round-trip: decode the input with
+                   -decoder, encode the decoder output with -encoder, and
+                   decode the encoder output with -decoder again. The result is
+                   compared to the expected JSON. Failures show the stage that
+                   failed: "decode", "encode", or "decode-encoded". Requires
+                   -encoder.
+
+                   Skipping a test with -skip also skips all variants of it.
+
     -errors        TOML or JSON file with expected errors for invalid test
                    files; an invalid test is considered to be "failed" if the
                    output doesn't contain the string in the file. This is
@@ -213,10 +362,69 @@ There are three types of tests:
                        "table/equals-sign"              = "expected error text"
                        "invalid/float/exp-point-1.toml" = "error"
 
+                   The key can be a glob, such as "string/*"; an exact match
+                   is used over a glob, and a longer glob over a shorter one.
+                   Keys starting with valid/ check the warnings on stderr for
+                   valid tests, for use with -validity=exit-code.
+
+                   The value can be:
+
+                       "text"             Output must contain this text.
+                       '/regexp/'         Output must match this regexp.
+                       ["a", "/b/"]       Any of these must match.
+                       {contains = "a",   Table with "contains" and "regex"
+                        regex = "b",      (a string or list of alternatives),
+                        line = 3,         "line" where the error is (see
+                        toml = "1.1"}     -error-position-regex), and "toml"
+                                          to use it only for that version.
+
+                   Use a list of tables for different errors in different
+                   TOML versions:
+
+                       "key/newline" = [
+                           {toml = "1.0", contains = "newline"},
+                           {toml = "1.1", contains = "unexpected"},
+                       ]
+
                    It's not an error if a file is missing in the file, but it
                    is an error if the filename in the errors.toml file doesn't
                    exist.
 
+    -update-errors Write the current (normalized) output of the decoder for
+                   every rejected invalid test to the -errors file, instead of
+                   checking it. Existing entries for other tests and other
+                   TOML versions are kept. Later runs with -errors will fail
+                   if an error changes.
+
+    -normalize-errors
+                   Normalize the output before it's compared to or written to
+                   the -errors file, as a comma-separated list. The default is
+                   "paths,pids,ansi,exit"; use "none" to disable.
+
+                       paths   Replace absolute paths with "<path>".
+                       pids    Replace the decoder's PID with "<pid>".
+                       ansi    Remove ANSI escape codes, such as colours.
+                       exit    Remove the "Exit 1" line.
+
+    -error-position-regex
+                   Regular expression to find the error position in the
+                   output of invalid tests, with the line in a (?P<line>..)
+                   group and the column in an optional (?P<col>..) group. Can
+                   be added more than once; the first that matches is used.
+                   The default matches "line 3", "line 3, column 5", and
+                   "3:5".
+
+                   Some invalid tests have an expected position, in a
+                   [test].position file with "line" or "line:column", or as a
+                   "# error-position: 3:5" comment on the first line. The
+                   column is only checked if both the test and the output
+                   have one. A wrong or missing position fails the test as
+                   "wrong-position".
+
+    -error-position-warn
+                   Show a wrong or missing error position as a warning,
+                   rather than failing the test.
+
     -color         Output color; possible values:
 
                         always   Show test failures in bold and red.
@@ -226,6 +434,231 @@ There are three types of tests:
                    Default is "always", or "never" if NO_COLOR is set.
 `, `\x1b`, "\x1b")[1:]
 
+var usageBench = strings.ReplaceAll(`
+The "bench" command measures how fast a decoder or encoder is.
+
+Every document is sent to the decoder (and encoder, if given) -n times, after
+one warmup run. The documents are:
+
+    wide-table        Single table with many keys.
+    long-array        Single array with many integers.
+    deep-nesting      Many deeply nested arrays and inline tables.
+    huge-string       Single long string, with some escapes.
+    array-of-tables   Many [[array]] tables with mixed value types.
+    valid tests       All valid tests, added together as a single row; use
+                      -v to show every test.
+
+For every document the median and 95th percentile of the time it took is
+shown, as well as the throughput in MB/s.
+
+The startup overhead is measured by sending an empty document, and this is
+subtracted in the "net" column; the throughput is calculated from this. If
+the startup overhead is larger than the time for a document the net time and
+throughput are shown as "-".
+
+\x1b[1mFlags:\x1b[0m
+
+    -decoder       Decoder command to benchmark; see "help test".
+
+    -encoder       Encoder command to benchmark; see "help test".
+
+    -decoder-mode  How to run the decoder and encoder commands; see "help
+    -encoder-mode  test". The startup overhead is mostly zero with
+                   "persistent".
+
+    -compare       Decoder command to compare. Can be added more than once,
+                   and can be combined with -decoder. All decoders are shown
+                   side-by-side in a single table:
+
+                       % toml-test bench \
+                           -compare=./decoder-one \
+                           -compare='python3 decoder-two.py'
+
+    -n             Number of times to run every document. Default is 10.
+
+    -size          Size of the generated documents in KB. Default is 256.
+
+    -no-tests      Don't use the valid tests, only the generated documents.
+
+    -run, -skip    Valid tests to use; see "help test".
+
+    -toml          TOML version of the valid tests (1.0 or 1.1).
+
+    -timeout       Maximum time for a single run. Defaults to "10s".
+
+    -validity      How to decide if the input was rejected; see "help test".
+    -reject-exit-codes
+
+    -env           Extra environment variable as KEY=VAL; see "help test".
+
+    -shell         Run commands with "sh -c"; see "help test".
+
+    -v             Show every valid test, instead of adding them together.
+
+    -json          Output as JSON; all times are in nanoseconds.
+`, `\x1b`, "\x1b")[1:]
+
+var usageDiffImpl = strings.ReplaceAll(`
+The "diff-impl" command runs documents through several decoders, and reports
+the documents where they disagree with each other.
+
+Decoders disagree if one accepts a document that another rejects, if one
+crashes or times out, or if the JSON output differs. This doesn't look at what
+the test expects: if all decoders accept an invalid test they agree.
+
+All valid and invalid tests are used, unless files or directories are given as
+positional arguments; directories are read recursively for *.toml files. This
+is useful to find disagreements in real-world documents:
+
+    % toml-test diff-impl -decoder=./decoder-one -decoder=./decoder-two \
+        ~/.config/
+
+The exit code is 1 if any of the decoders disagree.
+
+\x1b[1mFlags:\x1b[0m
+
+    -decoder       Decoder command; must be given at least twice. See "help
+                   test".
+
+    -decoder-mode  How to run the decoder commands; see "help test".
+
+    -run, -skip    Tests to use; see "help test". Can't be used with files.
+
+    -toml          TOML version of the tests (1.0 or 1.1).
+
+    -parallel      Number of documents to run in parallel; see "help test".
+
+    -timeout       Maximum time for a single run. Defaults to "1s".
+
+    -validity      How to decide if the input was rejected; see "help test".
+    -reject-exit-codes
+
+    -env           Extra environment variable as KEY=VAL; see "help test".
+
+    -shell         Run commands with "sh -c"; see "help test".
+
+    -v             Also show the documents where all decoders agree.
+
+    -json          Output as JSON.
+`, `\x1b`, "\x1b")[1:]
+
+var usageFuzz = strings.ReplaceAll(`
+The "fuzz" command tests a decoder with randomly generated valid documents.
+
+The documents use nested tables, arrays of tables, dotted keys, inline tables,
+and all forms of keys, strings, numbers, and datetimes. Features from TOML 1.1
+are only used with -toml=1.1. The JSON description is generated with the
+document, and the decoder's output is compared to it just like the valid
+tests.
+
+Documents are generated from a seed; the same seed always gives the same
+document. Failing documents are written to the -save directory, in the same
+layout as the tests:
+
+    toml-test-fuzz/valid/fuzz/seed-«seed».toml
+    toml-test-fuzz/valid/fuzz/seed-«seed».json
+
+Use -print to show the document for a seed:
+
+    % toml-test fuzz -print -seed=42 -toml=1.1
+
+With -invalid the decoder is tested with invalid documents instead: a valid
+test is picked and mutated to make it invalid, for example by duplicating a
+key, redefining a table, removing a closing quote, adding a control character,
+or putting an underscore next to a decimal point. Use -run and -skip to select
+the valid tests to use.
+
+Mutants are only used if BurntSushi/toml rejects them. If the decoder accepts
+a mutant then all lines not needed to show the problem are removed, and it's
+written as a candidate invalid test:
+
+    toml-test-fuzz/invalid/fuzz/«mutation»-seed-«seed».toml
+
+The exit code is 1 if any of the documents failed.
+
+\x1b[1mFlags:\x1b[0m
+
+    -decoder       Decoder command; see "help test".
+
+    -decoder-mode  How to run the decoder command; see "help test".
+
+    -toml          TOML version (1.0 or 1.1).
+
+    -seed          Seed for the first document; the next documents use seed+1,
+                   seed+2, etc. Default is a random seed.
+
+    -n             Number of documents to generate. Default is 1000.
+
+    -max-depth     Maximum nesting of tables and arrays. Default is 4.
+
+    -max-keys      Maximum number of keys in a table or elements in an array.
+                   Default is 6.
+
+    -save          Directory to write failing documents to; set to an empty
+                   string to not write anything. Default is "toml-test-fuzz".
+
+    -print         Print the document and JSON for -seed, and exit.
+
+    -invalid       Test with mutated valid tests that should be rejected.
+
+    -run, -skip    Valid tests to mutate with -invalid; see "help test".
+
+    -parallel      Number of documents to run in parallel; see "help test".
+
+    -timeout       Maximum time for a single run. Defaults to "1s".
+
+    -validity      How to decide if the input was rejected; see "help test".
+    -reject-exit-codes
+
+    -env           Extra environment variable as KEY=VAL; see "help test".
+
+    -shell         Run commands with "sh -c"; see "help test".
+
+    -v             Also show documents that passed.
+`, `\x1b`, "\x1b")[1:]
+
+var usageReduce = strings.ReplaceAll(`
+The "reduce" command finds the smallest input that fails in the same way as a
+failing test, to make it easier to see what the problem is.
+
+The test to reduce is set with -run; this may be a glob pattern as long as it
+matches exactly one test:
+
+    % toml-test reduce -decoder=toml-test-decoder -run=valid/example
+
+Key/value pairs and tables, lines, and characters are removed from the input
+as long as the test still fails in the same way: an invalid test must still be
+accepted, or for valid tests the decoder must still reject the input, crash,
+or give wrong output for the same key. Valid tests are kept as valid TOML and
+invalid tests as invalid TOML, according to BurntSushi/toml; tests that
+BurntSushi/toml doesn't pass can't be reduced. Encoder tests are not
+supported.
+
+The reduced input and its JSON description are printed at the end, so they
+can be copied as-is.
+
+[1mFlags:[0m
+
+    -decoder       Decoder command; see "help test".
+
+    -decoder-mode  How to run the decoder command; see "help test".
+
+    -toml          TOML version (1.0 or 1.1).
+
+    -run           Test to reduce.
+
+    -timeout       Maximum time for a single run. Defaults to "1s".
+
+    -int-as-float  Integers are reported as floats; see "help test".
+
+    -validity      How to decide if the input was rejected; see "help test".
+    -reject-exit-codes
+
+    -env           Extra environment variable as KEY=VAL; see "help test".
+
+    -shell         Run commands with "sh -c"; see "help test".
+`, `\x1b`, "\x1b")[1:]
+
 var usageCopy = strings.ReplaceAll(`
 The "copy" command writes all test files to disk.
 
@@ -0,0 +1,136 @@
+package tomltest
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// SplitCommand splits a command line in to words, using the POSIX shell rules
+// for quoting:
+//
+//   - Words are separated by spaces, tabs, and newlines.
+//   - Everything between single quotes is used as-is.
+//   - Between double quotes a backslash only escapes $, `, ", \, and a newline.
+//   - Outside quotes a backslash escapes the next character.
+//
+// Variables, globs, and other shell features are not expanded.
+func SplitCommand(s string) ([]string, error) {
+	var (
+		words  []string
+		w      strings.Builder
+		inWord bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n':
+			if inWord {
+				words, inWord = append(words, w.String()), false
+				w.Reset()
+			}
+		case '\\':
+			inWord = true
+			if i+1 == len(s) {
+				return nil, errors.New("tomltest.SplitCommand: backslash at end of command")
+			}
+			i++
+			if s[i] != '\n' {
+				w.WriteByte(s[i])
+			}
+		case '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				return nil, errors.New("tomltest.SplitCommand: unterminated single quote")
+			}
+			w.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case '"':
+			inWord = true
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) > -1 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				w.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errors.New("tomltest.SplitCommand: unterminated double quote")
+			}
+		default:
+			inWord = true
+			w.WriteByte(c)
+		}
+	}
+	if inWord {
+		words = append(words, w.String())
+	}
+	return words, nil
+}
+
+// ShellQuote quotes s for use in a POSIX shell.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, `'`, `'"'"'`) + "'"
+}
+
+// hasPlaceholder reports if any of the arguments has a placeholder.
+func hasPlaceholder(args []string, names ...string) bool {
+	for _, a := range args {
+		for _, n := range names {
+			if strings.Contains(a, "{"+n+"}") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandCommand replaces the {file}, {version}, and {name} placeholders in the
+// arguments. The returned function removes the temporary file.
+//
+// If {file} is used the input is written to a temporary file, and stdin is
+// empty. Values are quoted if shell is set.
+func expandCommand(args []string, inv Invocation, input string, shell bool) ([]string, string, func(), error) {
+	if !hasPlaceholder(args, "file", "version", "name") {
+		return args, input, func() {}, nil
+	}
+
+	var (
+		file    string
+		cleanup = func() {}
+	)
+	if hasPlaceholder(args, "file") {
+		ext := ".toml"
+		if inv.Type == TypeEncoder.String() || inv.Type == TypeEncoderInvalid.String() {
+			ext = ".json"
+		}
+		fp, err := os.CreateTemp("", "toml-test-*"+ext)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		cleanup = func() { os.Remove(fp.Name()) }
+		_, err = fp.WriteString(input)
+		if err2 := fp.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			cleanup()
+			return nil, "", nil, err
+		}
+		file, input = fp.Name(), ""
+	}
+
+	q := func(s string) string { return s }
+	if shell {
+		q = ShellQuote
+	}
+	repl := strings.NewReplacer("{file}", q(file), "{version}", q(inv.Version), "{name}", q(inv.Name))
+	exp := make([]string, 0, len(args))
+	for _, a := range args {
+		exp = append(exp, repl.Replace(a))
+	}
+	return exp, input, cleanup, nil
+}
@@ -0,0 +1,93 @@
+package tomltest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr string
+	}{
+		{``, nil, ""},
+		{`  `, nil, ""},
+		{`a b  c`, []string{"a", "b", "c"}, ""},
+		{"a\tb\nc", []string{"a", "b", "c"}, ""},
+		{`a 'b c' "d e"`, []string{"a", "b c", "d e"}, ""},
+		{`a'b'"c"d`, []string{"abcd"}, ""},
+		{`'' ""`, []string{"", ""}, ""},
+		{`'a\b' "a\b" a\b`, []string{`a\b`, `a\b`, `ab`}, ""},
+		{`"a\"b\\c\$d"`, []string{`a"b\c$d`}, ""},
+		{`'a"b' "a'b"`, []string{`a"b`, `a'b`}, ""},
+		{`a\ b`, []string{"a b"}, ""},
+		{"a\\\nb", []string{"ab"}, ""},
+		{`$HOME *`, []string{"$HOME", "*"}, ""},
+
+		{`'a`, nil, "unterminated single quote"},
+		{`"a`, nil, "unterminated double quote"},
+		{`a\`, nil, "backslash at end"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			have, err := SplitCommand(tt.in)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error: %v", err)
+			}
+			if h, w := fmt.Sprintf("%q", have), fmt.Sprintf("%q", tt.want); h != w {
+				t.Errorf("\nhave: %s\nwant: %s", h, w)
+			}
+		})
+	}
+}
+
+func TestCommandPlaceholders(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	inv := Invocation{Version: "1.1.0", Name: "valid/it's", Type: "valid"}
+	ctx := WithInvocation(context.Background(), inv)
+
+	tests := []struct {
+		p    CommandParser
+		want string
+	}{
+		{NewCommandParser([]string{"sh", "-c", `echo "$1 $2"; cat`, "-", "{version}", "{name}"}),
+			"1.1.0 valid/it's\ninput"},
+		{NewCommandParser([]string{"sh", "-c", `echo "$(cat)"; cat "$1"`, "-", "{file}"}),
+			"input"},
+		{NewShellCommandParser(`echo {version} {name}; cat {file}`),
+			"1.1.0 valid/it's\ninput"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			r, err := tt.p.Exec(ctx, "input")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Stderr != "" || r.ExitCode != 0 {
+				t.Fatalf("exit %d: %s", r.ExitCode, r.Stderr)
+			}
+			if h := strings.TrimSpace(r.Stdout); h != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", h, tt.want)
+			}
+		})
+	}
+
+	// Temporary file should be removed.
+	p := NewCommandParser([]string{"echo", "{file}"})
+	r, err := p.Exec(ctx, "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(strings.TrimSpace(r.Stdout)); !os.IsNotExist(err) {
+		t.Errorf("temporary file not removed: %v", err)
+	}
+}
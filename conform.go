@@ -0,0 +1,143 @@
+package tomltest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	reDateValue = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}(([Tt ])([0-9]{2}:[0-9]{2})(:[0-9]{2})?(\.[0-9]+)?([Zz]|[+-][0-9]{2}:[0-9]{2})?)?`)
+	reTimeValue = regexp.MustCompile(`^[0-9]{2}:[0-9]{2}(:[0-9]{2})?`)
+)
+
+// checkEncoded checks if doc only uses syntax from the given TOML version, and
+// if there are any values that are valid but ambiguous.
+//
+// The document must already be valid TOML 1.1; this only looks at the syntax
+// that was added in TOML 1.1, which means that everything else is also valid
+// TOML 1.0:
+//
+//   - \e and \xHH escapes.
+//   - Newlines, comments, and trailing commas in inline tables.
+//   - Times without seconds.
+//
+// Every error and warning includes the line number.
+func checkEncoded(doc, version string) (errs, warns []string) {
+	var (
+		v10   = version == "1.0.0"
+		line  = 1
+		stack []byte // Open [ and { for arrays and inline tables.
+		last  byte   // Last non-whitespace character outside comments.
+	)
+	errf := func(format string, a ...any) {
+		if v10 {
+			errs = append(errs, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, a...)+" (added in TOML 1.1)")
+		}
+	}
+	warnf := func(format string, a ...any) {
+		warns = append(warns, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, a...))
+	}
+	inInline := func() bool { return len(stack) > 0 && stack[len(stack)-1] == '{' }
+
+	for i := 0; i < len(doc); i++ {
+		c := doc[i]
+		switch {
+		case c == '\n':
+			if inInline() {
+				errf("newline in inline table")
+			}
+			line++
+		case c == ' ' || c == '\t' || c == '\r':
+			continue
+		case c == '#':
+			for i < len(doc)-1 && doc[i+1] != '\n' {
+				i++
+			}
+			continue
+		case c == '[' && len(stack) == 0 && last != '=':
+			// Table header; skip to the end of the header.
+			for i < len(doc)-1 && doc[i+1] != '\n' && doc[i+1] != '#' {
+				i++
+				if doc[i] == '"' || doc[i] == '\'' {
+					i = skipString(doc, i, &line, errf)
+				}
+			}
+			c = ']'
+		case c == '[' || c == '{':
+			stack = append(stack, c)
+		case c == ']' || c == '}':
+			if c == '}' && last == ',' {
+				errf("trailing comma in inline table")
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case c == '"' || c == '\'':
+			i = skipString(doc, i, &line, errf)
+		case c >= '0' && c <= '9' && (last == '=' || (last == ',' || last == '[') && len(stack) > 0 && !inInline()):
+			if m := reDateValue.FindStringSubmatch(doc[i:]); m != nil {
+				if m[1] != "" {
+					if m[2] == " " {
+						warnf("datetime %q uses a space instead of T", m[0])
+					}
+					if m[2] == "t" || m[6] == "z" {
+						warnf("datetime %q uses a lower-case t or z", m[0])
+					}
+					if m[4] == "" {
+						errf("time without seconds in %q", m[0])
+					}
+					if m[6] == "-00:00" {
+						warnf("datetime %q uses the offset -00:00, which is often treated as an unknown offset", m[0])
+					}
+				}
+				i += len(m[0]) - 1
+			} else if m := reTimeValue.FindStringSubmatch(doc[i:]); m != nil {
+				if m[1] == "" {
+					errf("time without seconds in %q", m[0])
+				}
+				i += len(m[0]) - 1
+			}
+			c = '0'
+		}
+		last = c
+	}
+	return errs, warns
+}
+
+// skipString skips the string starting at doc[i], and returns the position of
+// the closing quote.
+func skipString(doc string, i int, line *int, errf func(string, ...any)) int {
+	var (
+		q     = doc[i]
+		multi = strings.HasPrefix(doc[i:], strings.Repeat(string(q), 3))
+	)
+	if multi {
+		i += 2
+	}
+	for i++; i < len(doc); i++ {
+		switch c := doc[i]; {
+		case c == '\n':
+			*line++
+		case c == '\\' && q == '"' && i+1 < len(doc):
+			i++
+			switch doc[i] {
+			case 'e':
+				errf(`\e escape`)
+			case 'x':
+				errf(`\x escape`)
+			case '\n':
+				*line++
+			}
+		case c == q && !multi:
+			return i
+		case c == q && strings.HasPrefix(doc[i:], strings.Repeat(string(q), 3)):
+			i += 2
+			for i+1 < len(doc) && doc[i+1] == q { // Up to two quotes are allowed before the closing quotes.
+				i++
+			}
+			return i
+		}
+	}
+	return i
+}
@@ -0,0 +1,70 @@
+package tomltest
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCheckEncoded(t *testing.T) {
+	tests := []struct {
+		in         string
+		errs, warn string
+	}{
+		{`a = 1`, ``, ``},
+		{`a = "\e"`, `line 1: \e escape (added in TOML 1.1)`, ``},
+		{`a = "\\e \\x"`, ``, ``},
+		{"a = 'x'\nb = '''\\e'''\nc = \"\"\"\n\\x41\"\"\"", `line 4: \x escape (added in TOML 1.1)`, ``},
+		{`a = "\"" # \e`, ``, ``},
+		{"a = {\n b = 1}", `line 1: newline in inline table (added in TOML 1.1)`, ``},
+		{"a = {b = [\n1]}", ``, ``},
+		{"a = {b = 1,}", `line 1: trailing comma in inline table (added in TOML 1.1)`, ``},
+		{"a = [1,]", ``, ``},
+		{"a = 12:00", `line 1: time without seconds in "12:00" (added in TOML 1.1)`, ``},
+		{"a = [12:00:00, 13:00]", `line 1: time without seconds in "13:00" (added in TOML 1.1)`, ``},
+		{"a = 1979-05-27T07:32Z", `line 1: time without seconds in "1979-05-27T07:32Z" (added in TOML 1.1)`, ``},
+		{"a = 1979-05-27T07:32:00.999Z", ``, ``},
+		{"a = 1979-05-27", ``, ``},
+		{"a = '12:00'\n1979-05-27 = 1\n[\"12:00\"]\n[[x.\"\\e\"]]", `line 4: \e escape (added in TOML 1.1)`, ``},
+		{"a = 1979-05-27 07:32:00", ``, `line 1: datetime "1979-05-27 07:32:00" uses a space instead of T`},
+		{"a = 1979-05-27t07:32:00z", ``, `line 1: datetime "1979-05-27t07:32:00z" uses a lower-case t or z`},
+		{"a = 1979-05-27T07:32:00-00:00", ``, `line 1: datetime "1979-05-27T07:32:00-00:00" uses the offset -00:00, which is often treated as an unknown offset`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			errs, warn := checkEncoded(tt.in, "1.0.0")
+			if h := strings.Join(errs, "\n"); h != tt.errs {
+				t.Errorf("errs\nhave: %s\nwant: %s", h, tt.errs)
+			}
+			if h := strings.Join(warn, "\n"); h != tt.warn {
+				t.Errorf("warn\nhave: %s\nwant: %s", h, tt.warn)
+			}
+
+			errs, _ = checkEncoded(tt.in, "1.1.0")
+			if len(errs) > 0 {
+				t.Errorf("errors for 1.1: %s", errs)
+			}
+		})
+	}
+
+	files := fstest.MapFS{
+		"encoder/a.toml": &fstest.MapFile{Data: []byte(`a = "A"`)},
+		"encoder/a.json": &fstest.MapFile{Data: []byte(`{"a": {"type": "string", "value": "A"}}`)},
+		"valid/a.toml":   &fstest.MapFile{Data: []byte(`a = "A"`)},
+		"valid/a.json":   &fstest.MapFile{Data: []byte(`{"a": {"type": "string", "value": "A"}}`)},
+	}
+	dec := resultParser{`a = "A"`: {Stdout: `{"a": {"type": "string", "value": "A"}}`}}
+	enc := resultParser{`{"a": {"type": "string", "value": "A"}}`: {Stdout: `a = "\x41"`}}
+	for _, v := range []string{"1.0", "1.1"} {
+		tests, err := NewRunner(Runner{Decoder: dec, Encoder: enc, Files: files, Version: v}).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == "1.0" && (tests.FailedEncoder != 1 || !strings.Contains(tests.Tests[1].Failure, "not valid TOML 1.0.0")) {
+			t.Errorf("%s: wrong counts: %#v", v, tests)
+		}
+		if v == "1.1" && tests.PassedEncoder != 1 {
+			t.Errorf("%s: wrong counts: %#v", v, tests)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package tomltest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiffDoc is a document to run through several decoders.
+type DiffDoc struct {
+	Name   string  `json:"name"`   // Test path or filename.
+	Input  string  `json:"input"`  // TOML document.
+	Expect Outcome `json:"expect"` // OutcomePassed for valid tests, OutcomeRejected for invalid tests, OutcomeNone otherwise.
+}
+
+// DiffOutput is the output of a single decoder.
+type DiffOutput struct {
+	// OutcomePassed if the decoder accepted the document, OutcomeRejected if
+	// it was rejected, OutcomeCrashed or OutcomeTimedOut if the decoder didn't
+	// run correctly, or OutcomeFailed if it accepted the document but didn't
+	// write a valid JSON description.
+	Outcome Outcome `json:"outcome"`
+	Output  string  `json:"output"` // JSON output, the error, or the reason it failed.
+	Result
+}
+
+// Diff is the result of running a document through several decoders.
+type Diff struct {
+	DiffDoc
+	Outputs []DiffOutput `json:"outputs"` // Output for every decoder, in the same order as the decoders.
+	Failure string       `json:"failure"` // How the decoders disagree; blank if they all agree.
+	Key     string       `json:"key"`     // TOML key of the first differing value; may be blank.
+}
+
+// Disagree reports if the decoders disagree on this document.
+func (d Diff) Disagree() bool { return d.Failure != "" }
+
+// DiffDocs gets the valid and invalid tests in RunTests and not in SkipTests,
+// to use for Diff. Variants are ignored.
+func (r Runner) DiffDocs() ([]DiffDoc, error) {
+	if _, err := r.prepare(); err != nil {
+		return nil, fmt.Errorf("tomltest.Runner.DiffDocs: %w", err)
+	}
+
+	docs := make([]DiffDoc, 0, len(r.RunTests))
+	for _, p := range r.RunTests {
+		t := r.newTest(p)
+		if t.Encoder() || t.EncoderInvalid() || t.Variant() != "" || r.hasSkip(p) {
+			continue
+		}
+		_, in, err := t.ReadInput(r.Files)
+		if err != nil {
+			return nil, fmt.Errorf("tomltest.Runner.DiffDocs: %w", err)
+		}
+		d := DiffDoc{Name: p, Input: in, Expect: OutcomePassed}
+		if t.Invalid() {
+			d.Expect = OutcomeRejected
+		}
+		docs = append(docs, d)
+	}
+	return docs, nil
+}
+
+// Diff runs all documents through all decoders, and compares the results.
+//
+// Decoders disagree if one accepts a document that another rejects, if one
+// crashes or times out while another doesn't, or if the JSON descriptions
+// differ according to CompareJSON. Runner.Validity and Runner.RejectExitCodes
+// are used to decide if a decoder rejected the document.
+//
+// Documents are run in parallel according to Runner.Parallel. The returned
+// list is in the same order as docs; documents that weren't run because the
+// context was cancelled are not included.
+func (r Runner) Diff(ctx context.Context, decoders []Parser, docs []DiffDoc) []Diff {
+	if r.Parallel == 0 {
+		r.Parallel = 1
+	}
+	if r.Timeout == 0 {
+		r.Timeout = 1 * time.Second
+	}
+
+	var (
+		diffs = make([]Diff, len(docs))
+		done  = make([]bool, len(docs))
+		limit = make(chan struct{}, r.Parallel)
+		wg    sync.WaitGroup
+	)
+	for i := range docs {
+		select {
+		case limit <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-limit; wg.Done() }()
+			diffs[i] = r.diff(ctx, decoders, docs[i])
+			done[i] = ctx.Err() == nil
+		}(i)
+	}
+	wg.Wait()
+
+	list := diffs[:0]
+	for i, d := range diffs {
+		if done[i] {
+			list = append(list, d)
+		}
+	}
+	return list
+}
+
+func (r Runner) diff(ctx context.Context, decoders []Parser, doc DiffDoc) Diff {
+	var (
+		d    = Diff{DiffDoc: doc, Outputs: make([]DiffOutput, 0, len(decoders))}
+		have = make([]any, len(decoders))
+	)
+	for i, p := range decoders {
+		t := r.newTest("")
+		t.Input = doc.Input
+		t, err := t.runParser(ctx, p)
+		out := DiffOutput{Outcome: OutcomePassed, Output: t.Output, Result: t.Result}
+		switch {
+		case err != nil:
+			t = t.failErr(err)
+			out.Outcome, out.Output = t.Outcome, t.Failure
+		case t.OutputFromStderr:
+			out.Outcome = OutcomeRejected
+			if v := t.validity(); !v.rejected(t.ExitCode) {
+				out.Outcome, out.Output = OutcomeFailed, fmt.Sprintf("expected exit code %s, but the parser exited with %d:\n%s",
+					joinInts(v.rejectCodes(), " or "), t.ExitCode, t.Output)
+			}
+		default:
+			if err := json.Unmarshal([]byte(t.Output), &have[i]); err != nil {
+				out.Outcome, out.Output = OutcomeFailed, fmt.Sprintf("decode JSON output from parser:\n  %s", err)
+			}
+		}
+		d.Outputs = append(d.Outputs, out)
+	}
+
+	// Group by outcome, in the order the outcomes are first seen.
+	var (
+		order  []Outcome
+		groups = make(map[Outcome][]string)
+	)
+	for i, o := range d.Outputs {
+		if _, ok := groups[o.Outcome]; !ok {
+			order = append(order, o.Outcome)
+		}
+		groups[o.Outcome] = append(groups[o.Outcome], fmt.Sprintf("[%d]", i+1))
+	}
+	if len(order) > 1 {
+		msg := make([]string, 0, len(order))
+		for _, o := range order {
+			msg = append(msg, fmt.Sprintf("%s by %s", diffVerb(o), strings.Join(groups[o], " ")))
+		}
+		d.Failure = strings.Join(msg, "; ")
+		return d
+	}
+
+	// All accepted: compare the JSON to that of the first decoder.
+	if len(order) == 0 || order[0] != OutcomePassed {
+		return d
+	}
+	for i := 1; i < len(have); i++ {
+		t := r.newTest("").CompareJSON(have[0], have[i])
+		if t.Failed() {
+			// CompareJSON labels the values as "Expected" and "Your encoder".
+			label := strings.NewReplacer(
+				"Expected:     ", fmt.Sprintf("%-14s", "[1]:"),
+				"Your encoder: ", fmt.Sprintf("%-14s", fmt.Sprintf("[%d]:", i+1)))
+			d.Failure = fmt.Sprintf("output of [1] and [%d] differs: %s", i+1, label.Replace(t.Failure))
+			d.Key = t.Key
+			return d
+		}
+	}
+	return d
+}
+
+func diffVerb(o Outcome) string {
+	switch o {
+	case OutcomePassed:
+		return "accepted"
+	case OutcomeRejected:
+		return "rejected"
+	case OutcomeCrashed:
+		return "crashed"
+	case OutcomeTimedOut:
+		return "timed out"
+	default:
+		return "invalid output"
+	}
+}
@@ -0,0 +1,85 @@
+package tomltest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	var (
+		a = resultParser{
+			"same":   {Stdout: `{"a": {"type": "integer", "value": "1"}}`},
+			"value":  {Stdout: `{"a": {"type": "integer", "value": "1"}}`},
+			"reject": {Stderr: "oops", ExitCode: 1},
+			"both":   {Stderr: "oops", ExitCode: 1},
+			"crash":  {Stdout: `{}`},
+			"json":   {Stdout: `{}`},
+			"exit0":  {Stderr: "oops", ExitCode: 1},
+		}
+		b = resultParser{
+			"same":   {Stdout: `{"a": {"type": "integer", "value": "1"}}`},
+			"value":  {Stdout: `{"a": {"type": "integer", "value": "2"}}`},
+			"reject": {Stdout: `{}`},
+			"both":   {Stderr: "other error", ExitCode: 1},
+			"crash":  {Signal: "segmentation fault", ExitCode: -1},
+			"json":   {Stdout: `{`},
+			"exit0":  {Stderr: "x", ExitCode: 0},
+		}
+	)
+
+	tests := []struct {
+		input, wantFailure, wantKey string
+	}{
+		{"same", "", ""},
+		{"both", "", ""},
+		{"value", "output of [1] and [2] differs: Values for key \"a\" don't match:\n  [1]:          1\n  [2]:          2", "a"},
+		{"reject", "rejected by [1]; accepted by [2]", ""},
+		{"crash", "accepted by [1]; crashed by [2]", ""},
+		{"json", "accepted by [1]; invalid output by [2]", ""},
+		{"exit0", "rejected by [1]; invalid output by [2]", ""},
+		{"hang", "", ""}, // Both time out, so they agree.
+	}
+
+	docs := make([]DiffDoc, 0, len(tests))
+	for _, tt := range tests {
+		docs = append(docs, DiffDoc{Name: tt.input, Input: tt.input})
+	}
+	r := NewRunner(Runner{Parallel: 4, Timeout: 50 * time.Millisecond})
+	diffs := r.Diff(context.Background(), []Parser{a, b}, docs)
+	if len(diffs) != len(tests) {
+		t.Fatalf("len(diffs) = %d", len(diffs))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			d := diffs[i]
+			if d.Name != tt.input || len(d.Outputs) != 2 {
+				t.Fatalf("%#v", d)
+			}
+			if d.Failure != tt.wantFailure {
+				t.Errorf("failure\nhave: %q\nwant: %q", d.Failure, tt.wantFailure)
+			}
+			if d.Key != tt.wantKey {
+				t.Errorf("key\nhave: %q\nwant: %q", d.Key, tt.wantKey)
+			}
+		})
+	}
+
+	docs, err := NewRunner(Runner{RunTests: []string{"valid/string/*", "invalid/string/*"}}).DiffDocs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var valid, invalid int
+	for _, d := range docs {
+		switch d.Expect {
+		case OutcomePassed:
+			valid++
+		case OutcomeRejected:
+			invalid++
+		}
+	}
+	if valid == 0 || invalid == 0 || valid+invalid != len(docs) {
+		t.Errorf("valid=%d; invalid=%d; total=%d", valid, invalid, len(docs))
+	}
+}
@@ -0,0 +1,336 @@
+package tomltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ErrorMatch is an expected error message for a test.
+//
+// The output must contain one of the strings in Contains and match one of the
+// regular expressions in Regex, if set, and the error must be reported on Line
+// if it's not 0. The line is found with Runner.ErrorPositionRegex.
+type ErrorMatch struct {
+	Contains []string
+	Regex    []*regexp.Regexp
+	Line     int
+	Versions []string // Only use for these TOML versions; all versions if blank.
+}
+
+func (m ErrorMatch) String() string {
+	var s []string
+	if len(m.Contains) > 0 {
+		s = append(s, fmt.Sprintf("contains %s", quoteList(m.Contains)))
+	}
+	if len(m.Regex) > 0 {
+		re := make([]string, 0, len(m.Regex))
+		for _, r := range m.Regex {
+			re = append(re, "/"+r.String()+"/")
+		}
+		s = append(s, "matches "+strings.Join(re, " or "))
+	}
+	if m.Line > 0 {
+		s = append(s, fmt.Sprintf("is on line %d", m.Line))
+	}
+	return strings.Join(s, " and ")
+}
+
+func quoteList(l []string) string {
+	q := make([]string, 0, len(l))
+	for _, s := range l {
+		q = append(q, fmt.Sprintf("%q", s))
+	}
+	return strings.Join(q, " or ")
+}
+
+func (m ErrorMatch) forVersion(v string) bool {
+	if len(m.Versions) == 0 {
+		return true
+	}
+	for _, vv := range m.Versions {
+		if normalizeVersion(vv) == v {
+			return true
+		}
+	}
+	return false
+}
+
+// checkVersions checks that all versions in ErrorMatch.Versions are known.
+func checkVersions(v []string) error {
+	for _, vv := range v {
+		if _, ok := versions[normalizeVersion(vv)]; !ok || vv == "" {
+			return fmt.Errorf("unknown TOML version %q (supported: \"%s\")",
+				vv, strings.Join(Versions(), `", "`))
+		}
+	}
+	return nil
+}
+
+func (m ErrorMatch) match(output string, re []*regexp.Regexp) bool {
+	ok := len(m.Contains) == 0
+	for _, c := range m.Contains {
+		if strings.Contains(output, c) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	ok = len(m.Regex) == 0
+	for _, r := range m.Regex {
+		if r.MatchString(output) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	if m.Line > 0 {
+		p, found := findPosition(output, re)
+		return found && p.Line == m.Line
+	}
+	return true
+}
+
+// ParseErrors parses an errors file in TOML or JSON format.
+//
+// The key is the test name, with or without "invalid/" and ".toml", and may be
+// a glob pattern such as "invalid/string/*". Keys for valid tests must start
+// with "valid/"; these are matched against warnings on stderr (see
+// Runner.Validity) rather than errors.
+//
+// The value is one of:
+//
+//   - A string, which the output must contain. Strings starting and ending with
+//     a "/" are a regular expression: "/line \d+/".
+//   - A table with the keys "contains" and "regex" (both a string or list of
+//     strings, which are alternatives), "line" (a number), and "toml" (a TOML
+//     version or list of versions).
+//   - A list of strings or tables, any of which may match.
+//
+// For example:
+//
+//	"table/equals-sign"        = "expected error text"
+//	"invalid/string/bad-esc-*" = '/line \d+: invalid escape/'
+//	"key/empty"                = ["empty key", "expected a key"]
+//	"integer/leading-zero-1"   = {contains = "leading zero", line = 1}
+//	"key/newline"              = [{toml = "1.0", contains = "newline"},
+//	                              {toml = "1.1", contains = "unexpected"}]
+func ParseErrors(data []byte, isJSON bool) (map[string][]ErrorMatch, error) {
+	var raw map[string]any
+	if isJSON {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := toml.Decode(string(data), &raw); err != nil {
+			return nil, err
+		}
+	}
+
+	m := make(map[string][]ErrorMatch, len(raw))
+	for k, v := range raw {
+		matches, err := parseErrorEntry(v, true)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", k, err)
+		}
+		m[k] = matches
+	}
+	return m, nil
+}
+
+func parseErrorEntry(v any, allowList bool) ([]ErrorMatch, error) {
+	switch vv := v.(type) {
+	case string:
+		m, err := parseErrorString(vv)
+		return []ErrorMatch{m}, err
+	case map[string]any:
+		var (
+			m   ErrorMatch
+			err error
+		)
+		for k, v := range vv {
+			switch k {
+			case "contains":
+				m.Contains, err = stringList(k, v)
+			case "regex":
+				m.Regex, err = regexList(k, v)
+			case "line":
+				switch n := v.(type) {
+				case int64:
+					m.Line = int(n)
+				case float64:
+					m.Line = int(n)
+				default:
+					err = fmt.Errorf(`"line" must be a number, not %s`, fmtType(v))
+				}
+			case "toml":
+				m.Versions, err = stringList(k, v)
+				if err == nil {
+					err = checkVersions(m.Versions)
+				}
+			default:
+				err = fmt.Errorf("unknown key %q (must be contains, regex, line, or toml)", k)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(m.Contains) == 0 && len(m.Regex) == 0 && m.Line == 0 {
+			return nil, fmt.Errorf("must have at least one of contains, regex, or line")
+		}
+		return []ErrorMatch{m}, nil
+	case []any, []map[string]any:
+		if !allowList {
+			return nil, fmt.Errorf("lists can't be nested")
+		}
+		var l []any
+		if a, ok := vv.([]any); ok {
+			l = a
+		} else {
+			for _, t := range vv.([]map[string]any) {
+				l = append(l, t)
+			}
+		}
+		matches := make([]ErrorMatch, 0, len(l))
+		for _, v := range l {
+			m, err := parseErrorEntry(v, false)
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, m...)
+		}
+		return matches, nil
+	default:
+		return nil, fmt.Errorf("must be a string, table, or list, not %s", fmtType(v))
+	}
+}
+
+func parseErrorString(s string) (ErrorMatch, error) {
+	if len(s) > 1 && s[0] == '/' && s[len(s)-1] == '/' {
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		return ErrorMatch{Regex: []*regexp.Regexp{re}}, err
+	}
+	return ErrorMatch{Contains: []string{s}}, nil
+}
+
+func stringList(k string, v any) ([]string, error) {
+	switch vv := v.(type) {
+	case string:
+		return []string{vv}, nil
+	case []any:
+		l := make([]string, 0, len(vv))
+		for _, s := range vv {
+			ss, ok := s.(string)
+			if !ok {
+				return nil, fmt.Errorf("%q must be a string or list of strings", k)
+			}
+			l = append(l, ss)
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("%q must be a string or list of strings", k)
+}
+
+func regexList(k string, v any) ([]*regexp.Regexp, error) {
+	l, err := stringList(k, v)
+	if err != nil {
+		return nil, err
+	}
+	re := make([]*regexp.Regexp, 0, len(l))
+	for _, s := range l {
+		r, err := regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		re = append(re, r)
+	}
+	return re, nil
+}
+
+// AllNormalize lists all ways the output can be normalized with
+// NormalizeOutput and Runner.NormalizeErrors:
+//
+//	paths   Replace absolute paths with "<path>".
+//	pids    Replace the PID of the parser with "<pid>".
+//	ansi    Remove ANSI escape sequences, such as colours.
+//	exit    Remove the "Exit 1" line that's added to the output of rejected
+//	        input.
+var AllNormalize = []string{"paths", "pids", "ansi", "exit"}
+
+var (
+	reANSI = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+	rePath = regexp.MustCompile(`(^|[\s"'(\[=:,])(?:[A-Za-z]:\\|/)[\w.@+~-]+(?:[/\\][\w.@+~-]+)+`)
+	reExit = regexp.MustCompile(`(?:^|\n)Exit \d+\n?$`)
+)
+
+// NormalizeOutput normalizes the output of a parser, so it can be compared
+// between runs. See AllNormalize for the list of options.
+func NormalizeOutput(output string, pid int, opts []string) (string, error) {
+	for _, o := range opts {
+		switch o {
+		case "paths":
+			output = rePath.ReplaceAllString(output, "$1<path>")
+		case "pids":
+			if pid > 0 {
+				output = regexp.MustCompile(`\b`+strconv.Itoa(pid)+`\b`).ReplaceAllString(output, "<pid>")
+			}
+		case "ansi":
+			output = reANSI.ReplaceAllString(output, "")
+		case "exit":
+			output = reExit.ReplaceAllString(output, "")
+		default:
+			return "", fmt.Errorf("unknown normalize option %q (supported: \"%s\")",
+				o, strings.Join(AllNormalize, `", "`))
+		}
+	}
+	if len(opts) > 0 {
+		output = strings.TrimSpace(output)
+	}
+	return output, nil
+}
+
+// errorKey normalizes a key in Errors or ErrorMatches.
+func errorKey(k string) string {
+	if !strings.HasPrefix(k, "invalid/") && !strings.HasPrefix(k, "valid/") {
+		k = path.Join("invalid", k)
+	}
+	return strings.TrimSuffix(k, ".toml")
+}
+
+// findErrors finds the expected errors for the test path; an exact match is
+// used over a glob, and a longer glob is used over a shorter one.
+func (r Runner) findErrors(p string) (key string, m []ErrorMatch, ok bool) {
+	if m, ok := r.errors[p]; ok {
+		return p, m, true
+	}
+	globs := make([]string, 0, 4)
+	for k := range r.errors {
+		if strings.ContainsAny(k, "*?[") {
+			if ok, _ := path.Match(k, p); ok {
+				globs = append(globs, k)
+			}
+		}
+	}
+	if len(globs) == 0 {
+		return "", nil, false
+	}
+	sort.Slice(globs, func(i, j int) bool {
+		if len(globs[i]) != len(globs[j]) {
+			return len(globs[i]) > len(globs[j])
+		}
+		return globs[i] < globs[j]
+	})
+	return globs[0], r.errors[globs[0]], true
+}
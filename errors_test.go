@@ -0,0 +1,181 @@
+package tomltest
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in      string
+		json    bool
+		want    string
+		wantErr string
+	}{
+		{`"a" = "error"`, false, `a: contains "error"`, ""},
+		{`{"a": "error"}`, true, `a: contains "error"`, ""},
+		{`"a" = '/line \d+/'`, false, `a: matches /line \d+/`, ""},
+		{`"a" = ["x", "/y/"]`, false, `a: contains "x" | matches /y/`, ""},
+		{`"a" = {contains = ["x", "y"], regex = "z", line = 3}`, false,
+			`a: contains "x" or "y" and matches /z/ and is on line 3`, ""},
+		{`{"a": {"contains": "x", "line": 3, "toml": "1.1"}}`, true, `a: contains "x" and is on line 3 (1.1)`, ""},
+		{`"a" = [{toml = "1.0", contains = "x"}, {toml = ["1.1"], contains = "y"}]`, false,
+			`a: contains "x" (1.0) | contains "y" (1.1)`, ""},
+
+		{`"a" = 1`, false, "", `"a": must be a string, table, or list, not int64`},
+		{`"a" = {}`, false, "", `"a": must have at least one of contains, regex, or line`},
+		{`"a" = {contains = 1}`, false, "", `"a": "contains" must be a string or list of strings`},
+		{`"a" = {foo = "x"}`, false, "", `"a": unknown key "foo"`},
+		{`"a" = [["x"]]`, false, "", `"a": lists can't be nested`},
+		{`"a" = '/(/'`, false, "", `"a": error parsing regexp`},
+		{`"a" = {toml = "1,1", contains = "x"}`, false, "", `"a": unknown TOML version "1,1"`},
+		{`"a" = {toml = ["1.0", "1.2"], contains = "x"}`, false, "", `"a": unknown TOML version "1.2"`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			m, err := ParseErrors([]byte(tt.in), tt.json)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			have := make([]string, 0, len(m["a"]))
+			for _, e := range m["a"] {
+				s := e.String()
+				if len(e.Versions) > 0 {
+					s += " (" + strings.Join(e.Versions, ", ") + ")"
+				}
+				have = append(have, s)
+			}
+			if h := "a: " + strings.Join(have, " | "); h != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s", h, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorMatches(t *testing.T) {
+	files := fstest.MapFS{
+		"valid/a.toml":       &fstest.MapFile{Data: []byte(`a=1`)},
+		"valid/a.json":       &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+		"invalid/a.toml":     &fstest.MapFile{Data: []byte(`a=`)},
+		"invalid/b.toml":     &fstest.MapFile{Data: []byte(`b=`)},
+		"invalid/dir/c.toml": &fstest.MapFile{Data: []byte(`c=`)},
+	}
+	run := func(t *testing.T, version string, errs string) map[string]string {
+		t.Helper()
+		m, err := ParseErrors([]byte(errs), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests, err := NewRunner(Runner{
+			Decoder:      &testParser{},
+			Files:        files,
+			Version:      version,
+			ErrorMatches: m,
+		}).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		failed := make(map[string]string)
+		for _, test := range tests.Tests {
+			if test.Failed() {
+				failed[test.Path] = test.Failure
+			}
+		}
+		return failed
+	}
+
+	t.Run("glob", func(t *testing.T) {
+		failed := run(t, "1.0", `
+			"*"     = "error one"
+			"dir/*" = "/^oh noes/"
+			"b"     = ["error one", "error two"]
+		`)
+		if len(failed) != 0 {
+			t.Errorf("%q", failed)
+		}
+
+		failed = run(t, "1.0", `"invalid/*" = ["/^oh/", {line = 1}]`)
+		if len(failed) != 1 || !strings.Contains(failed["invalid/b"], `Expected an error which matches /^oh/;`) {
+			t.Errorf("%q", failed)
+		}
+	})
+
+	t.Run("version", func(t *testing.T) {
+		errs := `"a" = [{toml = "1.0", contains = "error one"}, {toml = "1.1", contains = "other"}]`
+		if failed := run(t, "1.0", errs); len(failed) != 0 {
+			t.Errorf("%q", failed)
+		}
+		if failed := run(t, "1.1", errs); len(failed) != 1 || failed["invalid/a"] == "" {
+			t.Errorf("%q", failed)
+		}
+		if failed := run(t, "1.1", `"a" = {toml = "1.0", contains = "other"}`); len(failed) != 0 {
+			t.Errorf("%q", failed)
+		}
+
+		// Test that only exists in 1.1.
+		if failed := run(t, "1.0", `"only-1.1" = {toml = "1.1", contains = "toml:"}`); len(failed) != 0 {
+			t.Errorf("%q", failed)
+		}
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		failed := run(t, "1.0", `"valid/a" = "deprecated"`)
+		if len(failed) != 1 || !strings.Contains(failed["valid/a"], "Expected a warning which") {
+			t.Errorf("%q", failed)
+		}
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		m := map[string][]ErrorMatch{"a": {{Contains: []string{"x"}, Versions: []string{"1.2"}}}}
+		_, err := NewRunner(Runner{Decoder: &testParser{}, Files: files, ErrorMatches: m}).Run()
+		if !errorContains(err, `invalid ErrorMatches "a": unknown TOML version "1.2"`) {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("unused", func(t *testing.T) {
+		m, _ := ParseErrors([]byte(`"x/*" = "error"`), false)
+		_, err := NewRunner(Runner{Decoder: &testParser{}, Files: files, ErrorMatches: m}).Run()
+		if !errorContains(err, `errors didn't match anything: ["invalid/x/*"]`) {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
+
+func TestNormalizeOutput(t *testing.T) {
+	all := AllNormalize
+	tests := []struct {
+		in      string
+		opts    []string
+		want    string
+		wantErr string
+	}{
+		{"error\nExit 1\n", nil, "error\nExit 1\n", ""},
+		{"error\nExit 1\n", all, "error", ""},
+		{"error\nExit 12", []string{"exit"}, "error", ""},
+		{"Exit 1 early\nExit 1", []string{"exit"}, "Exit 1 early", ""},
+		{"\x1b[1;31merror\x1b[0m: oops", all, "error: oops", ""},
+		{"/tmp/x/a.toml:1:2: oops", all, "<path>:1:2: oops", ""},
+		{`open "C:\Temp\a.toml": oops`, all, `open "<path>": oops`, ""},
+		{"a/b: at line 1/2", all, "a/b: at line 1/2", ""},
+		{"[pid 4242] error; 42424", all, "[pid <pid>] error; 42424", ""},
+		{"[pid 4242] error", []string{"paths"}, "[pid 4242] error", ""},
+
+		{"", []string{"colour"}, "", `unknown normalize option "colour"`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have, err := NormalizeOutput(tt.in, 4242, tt.opts)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package tomltest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locations used for local datetimes, dates, and times by AddTags and
+// RemoveTags.
+//
+// Only the name is used to identify local datetimes, so any *time.Location
+// with the same name works (BurntSushi/toml uses the same names).
+var (
+	LocalDatetime = time.FixedZone("datetime-local", 0)
+	LocalDate     = time.FixedZone("date-local", 0)
+	LocalTime     = time.FixedZone("time-local", 0)
+)
+
+// FuncParser calls a Go function, rather than an external command.
+//
+// Set Decode to use it as a decoder, or Encode to use it as an encoder. Decode
+// should return the TOML document as native Go values, which are converted to
+// the JSON description with AddTags. Encode gets the native Go values from
+// RemoveTags, and should return the TOML document; JSON descriptions that
+// RemoveTags can't convert are rejected without calling Encode.
+//
+// Returning an error means the input was rejected. A panic is reported as a
+// crash. The context is cancelled once the timeout expires; the function should
+// return when that happens, but the test fails with a timeout error even if it
+// doesn't.
+type FuncParser struct {
+	Name   string // Name to display in the output; defaults to "(func)".
+	Decode func(ctx context.Context, toml []byte) (any, error)
+	Encode func(ctx context.Context, v any) ([]byte, error)
+}
+
+func (f FuncParser) Cmd() []string {
+	if f.Name == "" {
+		return []string{"(func)"}
+	}
+	return []string{f.Name}
+}
+
+func (f FuncParser) Run(ctx context.Context, input string) (pid int, output string, outputIsError bool, err error) {
+	if (f.Decode == nil) == (f.Encode == nil) {
+		return 0, "", false, fmt.Errorf("tomltest.FuncParser: must set exactly one of Decode or Encode")
+	}
+
+	type result struct {
+		output        string
+		outputIsError bool
+		err           error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				ch <- result{err: fmt.Errorf("panic: %v\n\n%s", r, debug.Stack())}
+			}
+		}()
+		var res result
+		if f.Decode != nil {
+			res.output, res.outputIsError, res.err = f.decode(ctx, input)
+		} else {
+			res.output, res.outputIsError, res.err = f.encode(ctx, input)
+		}
+		ch <- res
+	}()
+
+	select {
+	case res := <-ch:
+		return os.Getpid(), res.output, res.outputIsError, res.err
+	case <-ctx.Done():
+		return os.Getpid(), "", false, ctx.Err()
+	}
+}
+
+func (f FuncParser) decode(ctx context.Context, input string) (string, bool, error) {
+	v, err := f.Decode(ctx, []byte(input))
+	if err != nil {
+		return strings.TrimSpace(err.Error()) + "\n", true, nil
+	}
+	tagged, err := AddTags(v)
+	if err != nil {
+		return "", false, err
+	}
+	j, err := json.Marshal(tagged)
+	if err != nil {
+		return "", false, err
+	}
+	return string(j) + "\n", false, nil
+}
+
+func (f FuncParser) encode(ctx context.Context, input string) (string, bool, error) {
+	var tagged any
+	if err := json.Unmarshal([]byte(input), &tagged); err != nil {
+		return "", false, fmt.Errorf("decode JSON input: %w", err)
+	}
+	v, err := RemoveTags(tagged)
+	if err != nil { // Invalid JSON description; see the encoder-invalid tests.
+		return strings.TrimSpace(err.Error()) + "\n", true, nil
+	}
+	out, err := f.Encode(ctx, v)
+	if err != nil {
+		return strings.TrimSpace(err.Error()) + "\n", true, nil
+	}
+	return strings.TrimSpace(string(out)) + "\n", false, nil
+}
+
+// AddTags converts native Go values to the JSON description.
+//
+// Tables should be map[string]any, and arrays []any or []map[string]any. All
+// int, uint, and float types are supported, as are string and bool. A
+// time.Time is an offset datetime, unless the location has the same name as
+// LocalDatetime, LocalDate, or LocalTime.
+func AddTags(v any) (any, error) {
+	switch vv := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(vv))
+		for k, v := range vv {
+			var err error
+			m[k], err = AddTags(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []map[string]any:
+		a := make([]any, len(vv))
+		for i, v := range vv {
+			var err error
+			a[i], err = AddTags(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	case []any:
+		a := make([]any, len(vv))
+		for i, v := range vv {
+			var err error
+			a[i], err = AddTags(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	case time.Time:
+		switch vv.Location().String() {
+		case LocalDatetime.String():
+			return tag("datetime-local", vv.Format("2006-01-02T15:04:05.999999999")), nil
+		case LocalDate.String():
+			return tag("date-local", vv.Format("2006-01-02")), nil
+		case LocalTime.String():
+			return tag("time-local", vv.Format("15:04:05.999999999")), nil
+		default:
+			return tag("datetime", vv.Format("2006-01-02T15:04:05.999999999Z07:00")), nil
+		}
+	case string:
+		return tag("string", vv), nil
+	case bool:
+		return tag("bool", strconv.FormatBool(vv)), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return tag("integer", fmt.Sprintf("%d", vv)), nil
+	case float32:
+		return tagFloat(float64(vv)), nil
+	case float64:
+		return tagFloat(vv), nil
+	default:
+		return nil, fmt.Errorf("tomltest.AddTags: unsupported type %s", fmtType(v))
+	}
+}
+
+func tagFloat(f float64) map[string]any {
+	switch {
+	case math.IsNaN(f):
+		return tag("float", "nan")
+	case math.IsInf(f, 1):
+		return tag("float", "inf")
+	case math.IsInf(f, -1):
+		return tag("float", "-inf")
+	default:
+		return tag("float", strconv.FormatFloat(f, 'g', -1, 64))
+	}
+}
+
+func tag(typ, value string) map[string]any {
+	return map[string]any{"type": typ, "value": value}
+}
+
+// RemoveTags converts the JSON description to native Go values.
+//
+// This is the reverse of AddTags: tables are map[string]any, arrays are []any,
+// integers are int64, and floats are float64. Local datetimes, dates, and times
+// are a time.Time in the LocalDatetime, LocalDate, and LocalTime locations.
+func RemoveTags(v any) (any, error) {
+	switch vv := v.(type) {
+	case map[string]any:
+		if isValue(vv) {
+			return untag(vv)
+		}
+		m := make(map[string]any, len(vv))
+		for k, v := range vv {
+			var err error
+			m[k], err = RemoveTags(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []any:
+		a := make([]any, len(vv))
+		for i, v := range vv {
+			var err error
+			a[i], err = RemoveTags(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	default:
+		return nil, fmt.Errorf("tomltest.RemoveTags: unexpected %s; must be an object or array", fmtType(v))
+	}
+}
+
+func untag(m map[string]any) (any, error) {
+	typ, ok := m["type"].(string)
+	if !ok {
+		return nil, fmt.Errorf("tomltest.RemoveTags: 'type' is not a string but %s", fmtType(m["type"]))
+	}
+	if typ == "array" { // Not written by AddTags, but accepted by CompareJSON.
+		return RemoveTags(m["value"])
+	}
+	v, ok := m["value"].(string)
+	if !ok {
+		return nil, fmt.Errorf("tomltest.RemoveTags: 'value' is not a string but %s", fmtType(m["value"]))
+	}
+
+	var (
+		r   any
+		err error
+	)
+	switch typ {
+	case "string":
+		r = v
+	case "integer":
+		r, err = strconv.ParseInt(v, 10, 64)
+	case "float":
+		switch strings.ToLower(v) {
+		case "inf", "+inf":
+			r = math.Inf(1)
+		case "-inf":
+			r = math.Inf(-1)
+		case "nan", "+nan", "-nan":
+			r = math.NaN()
+		default:
+			r, err = strconv.ParseFloat(v, 64)
+		}
+	case "bool":
+		r, err = strconv.ParseBool(v)
+	case "datetime", "datetime-local", "date-local", "time-local":
+		var t time.Time
+		t, err = time.Parse(layouts[typ], datetimeRepl.Replace(v))
+		switch typ {
+		case "datetime-local":
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), LocalDatetime)
+		case "date-local":
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, LocalDate)
+		case "time-local":
+			t = time.Date(0, 1, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), LocalTime)
+		}
+		r = t
+	default:
+		return nil, fmt.Errorf("tomltest.RemoveTags: unknown type %q", typ)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tomltest.RemoveTags: invalid value for %q: %w", typ, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,104 @@
+package tomltest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestTags(t *testing.T) {
+	fsys := TestCases()
+	err := fs.WalkDir(fsys, "valid", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+		t.Run(path, func(t *testing.T) {
+			data, err := fs.ReadFile(fsys, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want any
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := RemoveTags(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := AddTags(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r := (Test{}).CompareJSON(want, have); r.Failed() {
+				t.Error(r.Failure)
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFuncParser(t *testing.T) {
+	r := NewRunner(Runner{
+		Decoder: FuncParser{Decode: func(ctx context.Context, data []byte) (any, error) {
+			switch string(data) {
+			case "panic=":
+				panic("oh noes")
+			case "hang=":
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return tomlDecode(ctx, data)
+		}},
+		Encoder: FuncParser{Encode: func(ctx context.Context, v any) ([]byte, error) {
+			b := new(bytes.Buffer)
+			err := toml.NewEncoder(b).Encode(v)
+			return b.Bytes(), err
+		}},
+		Timeout: 100 * time.Millisecond,
+		Files: fstest.MapFS{
+			"valid/a.toml":   &fstest.MapFile{Data: []byte(`a=1`)},
+			"valid/a.json":   &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"encoder/a.toml": &fstest.MapFile{Data: []byte(`a=1`)},
+			"encoder/a.json": &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"invalid/a.toml": &fstest.MapFile{Data: []byte(`a=`)},
+			"invalid/b.toml": &fstest.MapFile{Data: []byte(`panic=`)},
+			"invalid/c.toml": &fstest.MapFile{Data: []byte(`hang=`)},
+		},
+	})
+	tests, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests.Tests {
+		switch test.Path {
+		case "invalid/b":
+			if !strings.HasPrefix(test.Failure, "panic: oh noes") {
+				t.Errorf("wrong failure for %q: %q", test.Path, test.Failure)
+			}
+		case "invalid/c":
+			if !strings.Contains(test.Failure, "timed out") {
+				t.Errorf("wrong failure for %q: %q", test.Path, test.Failure)
+			}
+		default:
+			if test.Failed() {
+				t.Errorf("%s: %s", test.Path, test.Failure)
+			}
+		}
+	}
+	if tests.PassedValid != 1 || tests.PassedEncoder != 1 || tests.PassedInvalid != 1 || tests.FailedInvalid != 2 {
+		t.Errorf("PassedValid=%d; PassedEncoder=%d; PassedInvalid=%d; FailedInvalid=%d",
+			tests.PassedValid, tests.PassedEncoder, tests.PassedInvalid, tests.FailedInvalid)
+	}
+}
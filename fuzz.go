@@ -0,0 +1,668 @@
+package tomltest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing/fstest"
+	"time"
+)
+
+// Generator generates random valid TOML documents, together with the JSON
+// description of the document.
+//
+// The documents use nested tables, arrays of tables, dotted keys, inline
+// tables, and all forms of keys, strings, numbers, and datetimes. Features from
+// TOML 1.1 (newlines in inline tables, \e and \x escapes, times without
+// seconds) are only used if Version is 1.1.
+type Generator struct {
+	Version  string // TOML version; defaults to DefaultVersion.
+	MaxDepth int    // Maximum nesting of tables and arrays; defaults to 4.
+	MaxKeys  int    // Maximum number of keys in a table or elements in an array; defaults to 6.
+}
+
+// Generate a document. The same seed always generates the same document.
+func (g Generator) Generate(seed int64) (tomlDoc, jsonDoc string) {
+	if g.MaxDepth == 0 {
+		g.MaxDepth = 4
+	}
+	if g.MaxKeys == 0 {
+		g.MaxKeys = 6
+	}
+	gen := &generator{
+		rnd:      rand.New(rand.NewSource(seed)),
+		v11:      normalizeVersion(g.Version) == "1.1.0",
+		maxDepth: g.MaxDepth,
+		maxKeys:  g.MaxKeys,
+	}
+
+	root := gen.table(0)
+	b := new(strings.Builder)
+	gen.section(b, nil, root, false)
+
+	j, err := json.MarshalIndent(root.tagged(), "", "    ")
+	if err != nil {
+		panic(fmt.Sprintf("tomltest.Generator.Generate: %s", err)) // Should never happen.
+	}
+	return b.String(), string(j) + "\n"
+}
+
+// Fuzz generates a document with the seed, and runs it through the decoder as a
+// valid test named "valid/fuzz/seed-«seed»".
+//
+// The returned Test has Input and Want set to the TOML document and JSON
+// description, which can be written to the tests/ directory as-is. An error is
+// only returned if the Runner's options are invalid.
+func (r Runner) Fuzz(ctx context.Context, g Generator, seed int64) (Test, error) {
+	if err := r.setDefaults(); err != nil {
+		return Test{}, fmt.Errorf("tomltest.Runner.Fuzz: %w", err)
+	}
+	if g.Version == "" {
+		g.Version = r.Version
+	}
+
+	var (
+		name      = fmt.Sprintf("valid/fuzz/seed-%d", seed)
+		doc, want = g.Generate(seed)
+		t         = r.newTest(name)
+	)
+	t = t.RunContext(ctx, r.Decoder, fstest.MapFS{
+		name + ".toml": &fstest.MapFile{Data: []byte(doc)},
+		name + ".json": &fstest.MapFile{Data: []byte(want)},
+	})
+	t.Input, t.Want = doc, want
+	return t, nil
+}
+
+type (
+	generator struct {
+		rnd      *rand.Rand
+		v11      bool
+		maxDepth int
+		maxKeys  int
+	}
+
+	// genValue is a generated value; for tables and arrays of tables the TOML
+	// is written in section(), for everything else toml has the value as
+	// written in the document.
+	genValue struct {
+		kind  string     // TOML type, "array", "table", or "aot" (array of tables).
+		toml  string     // TOML for the value, for everything except tables.
+		json  any        // JSON value, for everything except tables and arrays.
+		items []genValue // Array elements or tables in an array of tables.
+		keys  []genKey   // Table keys.
+	}
+	genKey struct {
+		key string
+		val genValue
+	}
+)
+
+// tagged gets the JSON description.
+func (v genValue) tagged() any {
+	switch v.kind {
+	case "table":
+		m := make(map[string]any, len(v.keys))
+		for _, k := range v.keys {
+			m[k.key] = k.val.tagged()
+		}
+		return m
+	case "array", "aot":
+		l := make([]any, 0, len(v.items))
+		for _, i := range v.items {
+			l = append(l, i.tagged())
+		}
+		return l
+	default:
+		return map[string]any{"type": v.kind, "value": v.json}
+	}
+}
+
+func (g *generator) chance(n int) bool { return g.rnd.Intn(n) == 0 }
+
+func (g *generator) pick(s ...string) string { return s[g.rnd.Intn(len(s))] }
+
+// table generates a table with unique keys.
+func (g *generator) table(depth int) genValue {
+	var (
+		n    = g.rnd.Intn(g.maxKeys + 1)
+		t    = genValue{kind: "table", keys: make([]genKey, 0, n)}
+		seen = make(map[string]struct{}, n)
+	)
+	for i := 0; i < n; i++ {
+		k := g.key()
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		t.keys = append(t.keys, genKey{k, g.value(depth+1, true)})
+	}
+	return t
+}
+
+// value generates any value; tables and arrays of tables are only generated if
+// tables is set.
+func (g *generator) value(depth int, tables bool) genValue {
+	nested := depth < g.maxDepth
+	switch n := g.rnd.Intn(12); {
+	case n == 0 && nested && tables:
+		return g.table(depth)
+	case n == 1 && nested && tables:
+		aot := genValue{kind: "aot"}
+		for i := g.rnd.Intn(3) + 1; i > 0; i-- {
+			aot.items = append(aot.items, g.table(depth+1))
+		}
+		return aot
+	case n == 2 && nested:
+		return g.array(depth)
+	default:
+		return g.scalar()
+	}
+}
+
+func (g *generator) array(depth int) genValue {
+	a := genValue{kind: "array"}
+	for i := g.rnd.Intn(g.maxKeys + 1); i > 0; i-- {
+		if g.chance(6) && depth+1 < g.maxDepth {
+			a.items = append(a.items, g.table(depth+1)) // Written as inline table.
+		} else {
+			a.items = append(a.items, g.value(depth+1, false))
+		}
+	}
+	return a
+}
+
+func (g *generator) scalar() genValue {
+	switch g.rnd.Intn(8) {
+	case 0, 1:
+		s := g.str(false)
+		return genValue{kind: "string", toml: g.quote(s, true), json: s}
+	case 2:
+		return g.integer()
+	case 3:
+		return g.float()
+	case 4:
+		b := g.pick("true", "false")
+		return genValue{kind: "bool", toml: b, json: b}
+	default:
+		return g.datetime()
+	}
+}
+
+// key generates a key name; this is the raw key, and quote() is used to write
+// it.
+func (g *generator) key() string {
+	switch g.rnd.Intn(10) {
+	case 0:
+		return g.str(true)
+	case 1:
+		return g.pick("true", "false", "inf", "nan", "1", "123", "0x1", "1e3", "-", "_", "a-b_c")
+	case 2:
+		if g.chance(4) {
+			return ""
+		}
+		fallthrough
+	default:
+		const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-"
+		b := make([]byte, g.rnd.Intn(8)+1)
+		for i := range b {
+			b[i] = chars[g.rnd.Intn(len(chars))]
+		}
+		return string(b)
+	}
+}
+
+// str generates string content; single-line strings don't contain newlines.
+func (g *generator) str(singleLine bool) string {
+	var (
+		pool = []string{"a", "b", "Z", "0", "9", " ", " ", "\t", "\"", "'", "\\", "#", "=", ".", "[", "]",
+			"{", "}", ",", "é", "Ü", "漢", "€", "\U0001F600", " ", "\x00", "\x01", "\x1b", "\x7f", " "}
+		b = new(strings.Builder)
+	)
+	if !singleLine {
+		pool = append(pool, "\n", "\n", "\r")
+	}
+	for i := g.rnd.Intn(16); i > 0; i-- {
+		b.WriteString(pool[g.rnd.Intn(len(pool))])
+	}
+	return b.String()
+}
+
+// quote a string or key. Multi-line strings are only used if multiline is set.
+func (g *generator) quote(s string, multiline bool) string {
+	var (
+		hasQuote = strings.ContainsRune(s, '\'')
+		hasCtrl  = strings.IndexFunc(s, func(r rune) bool { return isCtrl(r) && r != '\t' && r != '\n' }) > -1
+		hasNL    = strings.ContainsRune(s, '\n')
+		bare     = s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-") == ""
+	)
+	if !multiline && bare && !g.chance(4) {
+		return s
+	}
+
+	switch n := g.rnd.Intn(4); {
+	case n == 0 && !hasQuote && !hasCtrl && !hasNL:
+		return "'" + s + "'"
+	case n == 1 && multiline && !hasQuote && !hasCtrl && !strings.Contains(s, "\r"):
+		if strings.HasPrefix(s, "\n") || g.chance(2) {
+			return "'''\n" + s + "'''" // Newline right after the delimiter is trimmed.
+		}
+		return "'''" + s + "'''"
+	case n == 2 && multiline:
+		b := new(strings.Builder)
+		b.WriteString(`"""`)
+		if g.chance(2) {
+			b.WriteString("\n")
+		}
+		for i, r := range s {
+			// Line-ending backslash; this also trims any whitespace after it,
+			// so don't add it before whitespace.
+			if i > 0 && r != ' ' && r != '\t' && r != '\n' && g.chance(10) {
+				b.WriteString("\\\n" + g.pick("", "  ", "\t", "\n  "))
+			}
+			if r == '\n' && !g.chance(3) && b.Len() > 4 {
+				b.WriteRune(r)
+			} else {
+				b.WriteString(g.escape(r))
+			}
+		}
+		b.WriteString(`"""`)
+		return b.String()
+	default:
+		b := new(strings.Builder)
+		b.WriteByte('"')
+		for _, r := range s {
+			b.WriteString(g.escape(r))
+		}
+		b.WriteByte('"')
+		return b.String()
+	}
+}
+
+func isCtrl(r rune) bool { return r < 0x20 || r == 0x7f }
+
+// escape a rune for a basic string, if needed. Regular characters are escaped
+// sometimes.
+func (g *generator) escape(r rune) string {
+	switch r {
+	case '"':
+		return `\"`
+	case '\\':
+		return `\\`
+	case '\b':
+		return `\b`
+	case '\t':
+		if g.chance(2) {
+			return `\t`
+		}
+		return "\t"
+	case '\n':
+		return `\n`
+	case '\f':
+		return `\f`
+	case '\r':
+		return `\r`
+	case 0x1b:
+		if g.v11 && g.chance(2) {
+			return `\e`
+		}
+	}
+	if isCtrl(r) || g.chance(8) {
+		switch n := g.rnd.Intn(3); {
+		case n == 0 && g.v11 && r < 0x100:
+			return fmt.Sprintf(`\x%02x`, r)
+		case n == 1 || r > 0xffff:
+			return fmt.Sprintf(`\U%08X`, r)
+		default:
+			return fmt.Sprintf(`\u%04x`, r)
+		}
+	}
+	return string(r)
+}
+
+// digits adds random underscores between digits.
+func (g *generator) digits(s string) string {
+	if len(s) < 2 || !g.chance(3) {
+		return s
+	}
+	b := new(strings.Builder)
+	for i, c := range s {
+		if i > 0 && g.chance(3) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (g *generator) integer() genValue {
+	var n int64
+	switch g.rnd.Intn(4) {
+	case 0:
+		n = int64(g.rnd.Intn(10))
+	case 1:
+		n = g.rnd.Int63()
+		if g.chance(2) {
+			n = -n - 1
+		}
+	default:
+		n = int64(g.rnd.Intn(200000) - 100000)
+	}
+	v := genValue{kind: "integer", json: strconv.FormatInt(n, 10)}
+
+	if n >= 0 {
+		var base int
+		switch g.rnd.Intn(8) {
+		case 0:
+			base = 16
+		case 1:
+			base = 8
+		case 2:
+			base = 2
+		}
+		if base > 0 {
+			d := strconv.FormatInt(n, base)
+			if g.chance(3) {
+				d = strings.Repeat("0", g.rnd.Intn(3)+1) + d
+			}
+			if base == 16 && g.chance(2) {
+				d = strings.ToUpper(d)
+			}
+			v.toml = map[int]string{16: "0x", 8: "0o", 2: "0b"}[base] + g.digits(d)
+			return v
+		}
+	}
+
+	d := strconv.FormatInt(n, 10)
+	if n >= 0 && g.chance(4) {
+		v.toml = "+" + g.digits(d)
+	} else if n < 0 {
+		v.toml = "-" + g.digits(d[1:])
+	} else {
+		v.toml = g.digits(d)
+	}
+	return v
+}
+
+func (g *generator) float() genValue {
+	if g.chance(6) {
+		s := g.pick("", "+", "-") + g.pick("inf", "nan")
+		return genValue{kind: "float", toml: s, json: strings.TrimPrefix(s, "+")}
+	}
+
+	var (
+		sign = g.pick("", "", "+", "-")
+		num  = strconv.Itoa(g.rnd.Intn(1000))
+		frac string
+		exp  string
+	)
+	if g.chance(4) {
+		num = strconv.FormatInt(g.rnd.Int63n(1e15), 10)
+	}
+	if n := g.rnd.Intn(3); n != 1 {
+		frac = strconv.Itoa(g.rnd.Intn(1e6))
+		if g.chance(3) {
+			frac = "0" + frac
+		}
+	}
+	if frac == "" || g.chance(3) {
+		exp = strconv.Itoa(g.rnd.Intn(290))
+		if g.chance(4) {
+			exp = "0" + exp
+		}
+		exp = g.pick("e", "E") + g.pick("", "+", "-") + exp
+	}
+
+	v := genValue{kind: "float", toml: sign + g.digits(num)}
+	if frac != "" {
+		v.toml += "." + g.digits(frac)
+	}
+	v.toml += exp
+	v.json = strings.TrimPrefix(strings.ReplaceAll(v.toml, "_", ""), "+")
+	return v
+}
+
+func (g *generator) datetime() genValue {
+	var (
+		t = time.Date(1900+g.rnd.Intn(200), time.Month(g.rnd.Intn(12)+1), g.rnd.Intn(28)+1,
+			g.rnd.Intn(24), g.rnd.Intn(60), g.rnd.Intn(60), 0, time.UTC)
+		frac    string
+		noSecs  = g.v11 && g.chance(5)
+		date    = t.Format("2006-01-02")
+		tm      = t.Format("15:04:05")
+		tomlTm  = tm
+		jsonVal string
+	)
+	if g.chance(1000) {
+		date = g.pick("0001-01-01", "9999-12-31")
+	}
+	if noSecs {
+		tomlTm = t.Format("15:04")
+		tm = tomlTm + ":00"
+	} else if g.chance(3) {
+		// Only use millisecond precision; implementations may truncate
+		// anything beyond that.
+		frac = "." + fmt.Sprintf("%03d", g.rnd.Intn(1000))[:g.rnd.Intn(3)+1]
+		tomlTm += frac
+		tm += frac
+	}
+
+	switch g.rnd.Intn(4) {
+	case 0:
+		return genValue{kind: "date-local", toml: date, json: date}
+	case 1:
+		return genValue{kind: "time-local", toml: tomlTm, json: tm}
+	case 2:
+		sep := g.pick("T", "t", " ")
+		return genValue{kind: "datetime-local", toml: date + sep + tomlTm, json: date + "T" + tm}
+	default:
+		sep := g.pick("T", "t", " ")
+		off := g.pick("Z", "z", "+00:00", "-00:00",
+			fmt.Sprintf("%s%02d:%02d", g.pick("+", "-"), g.rnd.Intn(24), g.rnd.Intn(60)))
+		jsonVal = date + "T" + tm + strings.ToUpper(off)
+		return genValue{kind: "datetime", toml: date + sep + tomlTm + off, json: jsonVal}
+	}
+}
+
+// ws gets some random whitespace.
+func (g *generator) ws() string {
+	if g.chance(2) {
+		return g.pick("", " ")
+	}
+	return g.pick("  ", "\t", " \t ")
+}
+
+// comment gets a random comment.
+func (g *generator) comment() string {
+	c := g.str(true)
+	c = strings.Map(func(r rune) rune {
+		if isCtrl(r) && r != '\t' {
+			return -1
+		}
+		return r
+	}, c)
+	return g.ws() + "#" + c
+}
+
+func (g *generator) newline(b *strings.Builder) {
+	if g.chance(6) {
+		b.WriteString(g.comment())
+	}
+	b.WriteByte('\n')
+	if g.chance(8) {
+		if g.chance(2) {
+			b.WriteString(g.comment())
+		}
+		b.WriteByte('\n')
+	}
+}
+
+// keyPath writes a dotted key.
+func (g *generator) keyPath(path []string) string {
+	p := make([]string, 0, len(path))
+	for _, k := range path {
+		p = append(p, g.quote(k, false))
+	}
+	if g.chance(5) {
+		return strings.Join(p, g.ws()+"."+g.ws())
+	}
+	return strings.Join(p, ".")
+}
+
+type deferred struct {
+	path []string
+	val  genValue
+}
+
+// section writes a table body, followed by all the [table] and [[array]]
+// sections for sub-tables. The [header] is written unless path is empty.
+func (g *generator) section(b *strings.Builder, path []string, t genValue, aot bool) {
+	var (
+		later []deferred
+		body  = new(strings.Builder)
+	)
+	for _, k := range t.keys {
+		g.keyval(body, path, []string{k.key}, k.val, &later)
+	}
+
+	switch {
+	case aot:
+		b.WriteString(g.ws() + "[[" + g.ws() + g.keyPath(path) + g.ws() + "]]")
+		g.newline(b)
+	case len(path) > 0:
+		// Super-tables don't need to be defined if there are sub-tables.
+		if body.Len() == 0 && len(later) > 0 && g.chance(2) {
+			break
+		}
+		b.WriteString(g.ws() + "[" + g.ws() + g.keyPath(path) + g.ws() + "]")
+		g.newline(b)
+	}
+	b.WriteString(body.String())
+
+	for _, l := range later {
+		if l.val.kind == "aot" {
+			for _, item := range l.val.items {
+				g.section(b, l.path, item, true)
+			}
+		} else {
+			g.section(b, l.path, l.val, false)
+		}
+	}
+}
+
+// keyval writes a key/value pair to the table at path, or adds it to later if
+// it's written as a [table] or [[array]] section.
+//
+// key is the (dotted) key relative to path. Tables defined with dotted keys
+// only use dotted keys and inline tables, as tables defined with dotted keys
+// can't be defined with [table].
+func (g *generator) keyval(b *strings.Builder, path, key []string, v genValue, later *[]deferred) {
+	full := append(append(make([]string, 0, len(path)+len(key)), path...), key...)
+	switch {
+	case v.kind == "table" && len(key) == 1 && later != nil && g.chance(2):
+		*later = append(*later, deferred{full, v})
+		return
+	case v.kind == "aot" && len(key) == 1 && later != nil && g.chance(2):
+		*later = append(*later, deferred{full, v})
+		return
+	case v.kind == "table" && len(v.keys) > 0 && g.chance(2):
+		for _, k := range v.keys {
+			g.keyval(b, path, append(key[:len(key):len(key)], k.key), k.val, nil)
+		}
+		return
+	}
+
+	b.WriteString(g.pick("", "", "  ", "\t") + g.keyPath(key) + g.ws() + "=" + g.ws())
+	b.WriteString(g.inline(v))
+	g.newline(b)
+}
+
+// inline writes a value as an inline value.
+func (g *generator) inline(v genValue) string {
+	switch v.kind {
+	case "table":
+		return g.inlineTable(v)
+	case "array", "aot":
+		if len(v.items) == 0 {
+			return "[" + g.ws() + "]"
+		}
+		var (
+			b         = new(strings.Builder)
+			multiline = g.chance(2)
+		)
+		b.WriteByte('[')
+		for i, item := range v.items {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if multiline {
+				g.newline(b)
+				b.WriteString("    ")
+			} else {
+				b.WriteString(g.ws())
+			}
+			b.WriteString(g.inline(item))
+		}
+		if g.chance(3) {
+			b.WriteByte(',')
+		}
+		if multiline {
+			g.newline(b)
+		}
+		b.WriteString(g.ws() + "]")
+		return b.String()
+	default:
+		return v.toml
+	}
+}
+
+func (g *generator) inlineTable(t genValue) string {
+	if len(t.keys) == 0 {
+		return "{" + g.ws() + "}"
+	}
+
+	var (
+		// Newlines and a trailing comma are only allowed in TOML 1.1.
+		multiline = g.v11 && g.chance(3)
+		b         = new(strings.Builder)
+		pairs     []string
+	)
+	var add func(key []string, v genValue)
+	add = func(key []string, v genValue) {
+		if v.kind == "table" && len(v.keys) > 0 && g.chance(3) {
+			for _, k := range v.keys {
+				add(append(key[:len(key):len(key)], k.key), k.val)
+			}
+			return
+		}
+		pairs = append(pairs, g.keyPath(key)+g.ws()+"="+g.ws()+g.inline(v))
+	}
+	for _, k := range t.keys {
+		add([]string{k.key}, k.val)
+	}
+
+	b.WriteByte('{')
+	for i, p := range pairs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if multiline {
+			g.newline(b)
+			b.WriteString("    ")
+		} else {
+			b.WriteString(g.ws())
+		}
+		b.WriteString(p)
+	}
+	if multiline {
+		if g.chance(2) {
+			b.WriteByte(',')
+		}
+		g.newline(b)
+	}
+	b.WriteString(g.ws() + "}")
+	return b.String()
+}
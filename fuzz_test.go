@@ -0,0 +1,74 @@
+package tomltest
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestGenerator(t *testing.T) {
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		t.Run(v, func(t *testing.T) {
+			g := Generator{Version: v}
+			for seed := int64(0); seed < 2000; seed++ {
+				doc, want := g.Generate(seed)
+				if d, w := g.Generate(seed); d != doc || w != want {
+					t.Fatalf("seed %d: not reproducible", seed)
+				}
+				if v == "1.0.0" && (strings.Contains(doc, `\e`) || strings.Contains(doc, `\x`)) {
+					t.Fatalf("seed %d: TOML 1.1 escape in 1.0 document:\n%s", seed, doc)
+				}
+
+				// BurntSushi/toml v1.6.0 sometimes drops values if there are
+				// empty keys, for example in:
+				//
+				//   a = [1, {"" = 1}]
+				if strings.Contains(want, `"": `) {
+					continue
+				}
+
+				var have any
+				if _, err := toml.Decode(doc, &have); err != nil {
+					t.Fatalf("seed %d: %s\n%s", seed, err, doc)
+				}
+				have, err := AddTags(have)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var w any
+				if err := json.Unmarshal([]byte(want), &w); err != nil {
+					t.Fatal(err)
+				}
+				if tt := (Test{}).CompareJSON(w, have); tt.Failed() {
+					t.Fatalf("seed %d: %s\n%s\n%s", seed, tt.Failure, doc, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	r := NewRunner(Runner{Decoder: FuncParser{Decode: tomlDecode}})
+	for seed := int64(0); seed < 10; seed++ {
+		tt, err := r.Fuzz(context.Background(), Generator{}, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(tt.Want, `"": `) { // See TestGenerator
+			continue
+		}
+		if tt.Failed() || tt.Outcome != OutcomePassed {
+			t.Fatalf("%s: %s", tt.Path, tt.Failure)
+		}
+		if tt.Want == "" {
+			t.Fatalf("%s: Want not set", tt.Path)
+		}
+	}
+	r.Validity = "x"
+	if _, err := r.Fuzz(context.Background(), Generator{}, 1); !errorContains(err, `unknown Validity: "x"`) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
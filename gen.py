@@ -1,32 +1,12 @@
 #!/usr/bin/env python3
 
-import argparse, pathlib, shutil, re, subprocess, os, tempfile, glob, os.path
+import argparse, pathlib, shutil, re, subprocess, os, tempfile, os.path
 
 ROOT = pathlib.Path(__file__).parent
 VALID_ROOT = ROOT / f"tests/valid/spec"
 INVALID_ROOT = ROOT / f"tests/invalid/spec"
 DECODER = ''
 
-def gen_multi():
-    for f in glob.glob(str(ROOT / 'tests/*/*/*.multi')):
-        base = os.path.dirname(f[:-6])
-        i = 1
-        for line in open(f, 'rb').readlines():
-            name = line.split(b'=')[0].strip().decode()
-            if name == '' or name[0] == '#':
-                continue
-            if '/valid/' in f:
-                name = f'{os.path.basename(f[:-6])}-{i:02}'
-                i += 1
-
-            line = re.sub(r'(?<=[^\\])\\x([0-9a-fA-F]{2})', lambda m: chr(int(m[1], 16)), line.decode())
-            path = base + "/" + name + '.toml'
-            with open(path, 'wb+') as fp:
-                fp.write(line.encode())
-
-            if '/valid/' in f:  # TODO: version?
-                run_decoder('1.0.0', path, path[:-5] + '.json')
-
 def gen_list():
     with open('tests/files-toml-1.0.0', 'w+') as fp:
         subprocess.run(['go', 'run', './cmd/toml-test', 'list', '-toml=1.0.0'], stdout=fp)
@@ -168,7 +148,6 @@ if __name__ == "__main__":
         DECODER = os.path.join(tmp, 'toml-test-decoder')
         subprocess.run(['go', 'build', '-o', DECODER, 'github.com/BurntSushi/toml/cmd/toml-test-decoder'])
 
-        gen_multi()
         gen_spec('1.0.0', 'specs/v1.0.0.md')
         gen_spec('1.1.0', 'specs/v1.1.0.md')
         gen_list()
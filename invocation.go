@@ -0,0 +1,44 @@
+package tomltest
+
+import (
+	"context"
+	"os"
+)
+
+// Invocation describes what a parser is run for.
+//
+// The Runner adds this to the context passed to Parser.Run; use
+// InvocationFromContext to get it.
+type Invocation struct {
+	Version string   // TOML version, e.g. "1.0.0".
+	Name    string   // Test path, e.g. "valid/string/basic"; blank if not run for a test.
+	Type    string   // "valid", "invalid", "encoder", or "encoder-invalid"; blank if not run for a test.
+	Env     []string // Extra environment variables from Runner.Env, as "KEY=VAL".
+}
+
+type invocationKey struct{}
+
+// WithInvocation returns a copy of ctx with the Invocation added.
+func WithInvocation(ctx context.Context, inv Invocation) context.Context {
+	return context.WithValue(ctx, invocationKey{}, inv)
+}
+
+// InvocationFromContext gets the Invocation from the context, if any.
+func InvocationFromContext(ctx context.Context) (Invocation, bool) {
+	inv, ok := ctx.Value(invocationKey{}).(Invocation)
+	return inv, ok
+}
+
+// Environ gets the environment to run a command with: the current environment,
+// TOML_TEST_VERSION, TOML_TEST_NAME, and TOML_TEST_TYPE, and Env. Variables
+// that are blank are not added.
+func (inv Invocation) Environ() []string {
+	env := append(os.Environ(), "TOML_TEST_VERSION="+inv.Version)
+	if inv.Name != "" {
+		env = append(env, "TOML_TEST_NAME="+inv.Name)
+	}
+	if inv.Type != "" {
+		env = append(env, "TOML_TEST_TYPE="+inv.Type)
+	}
+	return append(env, inv.Env...)
+}
@@ -0,0 +1,121 @@
+package tomltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"zgo.at/jfmt"
+)
+
+// A .multi file contains several tests, one per line. Every line is run as a
+// separate test, with the path "[file].multi#[name]".
+//
+// For invalid tests the name is the key, e.g.
+// "invalid/float/float.multi#exp-point-1" for the line "exp-point-1 = 1e2.3".
+// For valid tests the name is the number of the test, e.g.
+// "valid/key/numeric.multi#01"; the JSON for valid tests is generated by
+// decoding the line with BurntSushi/toml.
+//
+// Blank lines and lines starting with a "#" are skipped. "\xNN" sequences are
+// replaced with the literal character, so control characters can be tested.
+type multiTest struct {
+	name  string
+	input string
+}
+
+// readMulti reads all tests from a .multi file.
+func readMulti(fsys fs.FS, path string) ([]multiTest, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		valid = !strings.HasPrefix(path, "invalid/")
+		tests = make([]multiTest, 0, 16)
+		seen  = make(map[string]struct{})
+		n     = 1
+	)
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		k, _, _ := bytes.Cut(line, []byte("="))
+		name := string(bytes.TrimSpace(k))
+		if name == "" || name[0] == '#' {
+			continue
+		}
+		if valid {
+			name = fmt.Sprintf("%02d", n)
+			n++
+		}
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%s: duplicate name %q", path, name)
+		}
+		seen[name] = struct{}{}
+
+		tests = append(tests, multiTest{name: name, input: unescapeMulti(string(line))})
+	}
+	return tests, nil
+}
+
+// unescapeMulti replaces "\xNN" with the literal character, unless the
+// backslash is escaped.
+func unescapeMulti(s string) string {
+	b := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i > 0 && s[i-1] != '\\' && i+4 <= len(s) && s[i+1] == 'x' {
+			if n, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteRune(rune(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// readMultiTest reads a single test from a .multi file, as either TOML or the
+// JSON description.
+func readMultiTest(fsys fs.FS, path, name string, asJSON bool) (string, error) {
+	tests, err := readMulti(fsys, path)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tests {
+		if t.name != name {
+			continue
+		}
+		if !asJSON {
+			return t.input, nil
+		}
+
+		j, err := referenceJSON(t.input)
+		if err != nil {
+			return "", fmt.Errorf("%s#%s: %w", path, name, err)
+		}
+		return j, nil
+	}
+	return "", fmt.Errorf("%s: no test named %q", path, name)
+}
+
+// referenceJSON gets the JSON description of a TOML document, as decoded by
+// BurntSushi/toml.
+func referenceJSON(doc string) (string, error) {
+	var v any
+	if _, err := toml.Decode(doc, &v); err != nil {
+		return "", fmt.Errorf("decode with BurntSushi/toml: %w", err)
+	}
+	tagged, err := AddTags(v)
+	if err != nil {
+		return "", err
+	}
+	j, err := json.Marshal(tagged)
+	if err != nil {
+		return "", err
+	}
+	return jfmt.NewFormatter(80, "", "    ").FormatString(string(j))
+}
@@ -0,0 +1,522 @@
+package tomltest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing/fstest"
+
+	"github.com/BurntSushi/toml"
+)
+
+// FuzzInvalid applies a random mutation that makes a document invalid to one
+// of docs, and runs it through the decoder as an invalid test named
+// "invalid/fuzz/«mutation»-seed-«seed»". The same seed and docs always give the
+// same mutation.
+//
+// Mutants that BurntSushi/toml accepts are never used, as the mutation may not
+// have made the document invalid in all contexts. If the decoder accepts the
+// mutant then all lines that aren't needed to show the problem are removed, and
+// the Input of the returned Test is set to that.
+//
+// The test is skipped if none of the mutations could be applied. An error is
+// only returned if the Runner's options are invalid.
+func (r Runner) FuzzInvalid(ctx context.Context, docs []BenchDoc, seed int64) (Test, error) {
+	if err := r.setDefaults(); err != nil {
+		return Test{}, fmt.Errorf("tomltest.Runner.FuzzInvalid: %w", err)
+	}
+
+	var (
+		rnd  = rand.New(rand.NewSource(seed))
+		name string
+		from BenchDoc
+		mut  string
+	)
+	for try := 0; try < 100 && len(docs) > 0; try++ {
+		var (
+			d      = docs[rnd.Intn(len(docs))]
+			m      = mutations[rnd.Intn(len(mutations))]
+			mu, ok = m.apply(rnd, scanDoc(d.TOML))
+		)
+		if ok && rejected(mu) {
+			name, from, mut = fmt.Sprintf("invalid/fuzz/%s-seed-%d", m.name, seed), d, mu
+			break
+		}
+	}
+	if name == "" {
+		return Test{Path: fmt.Sprintf("invalid/fuzz/seed-%d", seed), Skipped: true, Outcome: OutcomeSkipped}, nil
+	}
+
+	run := func(input string) Test {
+		return r.newTest(name).RunContext(ctx, r.Decoder, fstest.MapFS{
+			name + ".toml": &fstest.MapFile{Data: []byte(input)},
+		})
+	}
+	t := run(mut)
+	if !t.Failed() || t.OutputFromStderr || t.Outcome != OutcomeFailed {
+		return t, nil
+	}
+
+	small := minimizeMutant(from.TOML, mut, func(s string) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		tt := r.newTest(name)
+		tt.Input = s
+		tt, err := tt.runParser(ctx, r.Decoder)
+		return err == nil && !tt.OutputFromStderr
+	})
+	if ctx.Err() != nil {
+		t.Failure += fmt.Sprintf("\n\nMutated from %s.", from.Name)
+		return t, nil
+	}
+	t = run(small)
+	t.Failure += fmt.Sprintf("\n\nMutated from %s; minimized from %d to %d bytes.", from.Name, len(mut), len(t.Input))
+	return t, nil
+}
+
+// minimizeMutant removes as many lines as possible around the mutation in mut,
+// for which accepted still returns true.
+//
+// The mutated lines are always kept, and the lines are only removed if the
+// document with the original lines instead of the mutated ones is still valid,
+// so that the result is invalid because of the mutation and not because of
+// something else.
+func minimizeMutant(orig, mut string, accepted func(string) bool) string {
+	var (
+		a, b     = strings.SplitAfter(orig, "\n"), strings.SplitAfter(mut, "\n")
+		pre, suf int
+	)
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var (
+		was   = strings.Join(a[pre:len(a)-suf], "")
+		is    = strings.Join(b[pre:len(b)-suf], "")
+		lines = make([]int, 0, pre+suf) // Index of lines in b around the mutation.
+	)
+	for i := range b {
+		if i < pre || i >= len(b)-suf {
+			lines = append(lines, i)
+		}
+	}
+	join := func(lines []int, mid string) string {
+		var s strings.Builder
+		added := false
+		for _, l := range lines {
+			if !added && l >= pre {
+				s.WriteString(mid)
+				added = true
+			}
+			s.WriteString(b[l])
+		}
+		if !added {
+			s.WriteString(mid)
+		}
+		return s.String()
+	}
+
+	lines = ddmin(lines, func(lines []int) bool {
+		s := join(lines, is)
+		return rejected(s) && !rejected(join(lines, was)) && accepted(s)
+	})
+	return join(lines, is)
+}
+
+// rejected reports if BurntSushi/toml rejects the document.
+func rejected(doc string) bool {
+	var v any
+	_, err := toml.Decode(doc, &v)
+	return err != nil
+}
+
+// docLine is the start of a key/value pair or table header in a document.
+type docLine struct {
+	line    int    // Line number, starting at 0.
+	kind    byte   // 'k' for key/value, 't' for [table], 'a' for [[array]].
+	key     string // Key or table name as written.
+	value   string // Value up to the end of the line or comment.
+	valueAt int    // Byte offset of the value in the line.
+	oneLine bool   // Value ends on this line.
+}
+
+type scannedDoc struct {
+	lines []string
+	found []docLine
+}
+
+func (d scannedDoc) String() string { return strings.Join(d.lines, "") }
+
+// pick a random line for which fn returns true.
+func (d scannedDoc) pick(rnd *rand.Rand, fn func(docLine) bool) (docLine, bool) {
+	var l []docLine
+	for _, f := range d.found {
+		if fn(f) {
+			l = append(l, f)
+		}
+	}
+	if len(l) == 0 {
+		return docLine{}, false
+	}
+	return l[rnd.Intn(len(l))], true
+}
+
+// replace line n with the result of fn.
+func (d scannedDoc) replace(n int, fn func(string) string) string {
+	lines := append([]string{}, d.lines...)
+	lines[n] = fn(lines[n])
+	return strings.Join(lines, "")
+}
+
+// scanDoc finds all key/value pairs and table headers in a document.
+//
+// This isn't a full parser: it just tracks enough state (strings, comments,
+// arrays, and inline tables) to know where the lines that start a key/value
+// pair or header are.
+func scanDoc(doc string) scannedDoc {
+	var (
+		d     = scannedDoc{lines: strings.SplitAfter(doc, "\n")}
+		multi string // In multi-line string with this delimiter.
+		depth int    // Depth of arrays and inline tables.
+	)
+	for i, line := range d.lines {
+		if multi != "" || depth > 0 {
+			multi, depth, _ = scanLine(line, 0, multi, depth)
+			continue
+		}
+
+		trim := strings.TrimLeft(line, " \t")
+		switch {
+		case trim == "" || trim[0] == '#' || trim[0] == '\n' || trim[0] == '\r':
+		case strings.HasPrefix(trim, "[["):
+			d.found = append(d.found, docLine{line: i, kind: 'a', key: strings.TrimSpace(headerName(trim[2:]))})
+		case trim[0] == '[':
+			d.found = append(d.found, docLine{line: i, kind: 't', key: strings.TrimSpace(headerName(trim[1:]))})
+		default:
+			eq := keyEnd(line)
+			if eq == -1 {
+				continue
+			}
+			at := eq + 1
+			for at < len(line) && (line[at] == ' ' || line[at] == '\t') {
+				at++
+			}
+			var end int
+			multi, depth, end = scanLine(line, at, multi, depth)
+			d.found = append(d.found, docLine{
+				line:    i,
+				kind:    'k',
+				key:     strings.TrimSpace(line[:eq]),
+				value:   strings.TrimRight(line[at:end], " \t\r\n"),
+				valueAt: at,
+				oneLine: multi == "" && depth == 0,
+			})
+		}
+	}
+	return d
+}
+
+// headerName gets the name from a header, without the closing ] or ]].
+func headerName(s string) string {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			if j := strings.IndexByte(s[i+1:], s[i]); j > -1 {
+				i += j + 1
+			}
+		case ']':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// keyEnd gets the position of the = after a key, or -1 if there is none.
+func keyEnd(line string) int {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"', '\'':
+			j := i + 1
+			for ; j < len(line) && line[j] != line[i]; j++ {
+				if line[i] == '"' && line[j] == '\\' {
+					j++
+				}
+			}
+			i = j
+		case '=':
+			return i
+		case '#', '\n':
+			return -1
+		}
+	}
+	return -1
+}
+
+// scanLine scans a line from position i, and returns the new state and the
+// position where the value ends (the start of a comment or the end of the
+// line).
+func scanLine(line string, i int, multi string, depth int) (string, int, int) {
+	for i < len(line) {
+		if multi != "" {
+			j := strings.Index(line[i:], multi)
+			if multi == `"""` {
+				for j > 0 && escaped(line[i:], j) {
+					k := strings.Index(line[i+j+1:], multi)
+					if k == -1 {
+						j = -1
+						break
+					}
+					j += k + 1
+				}
+			}
+			if j == -1 {
+				return multi, depth, len(line)
+			}
+			i += j + 3
+			for n := 0; n < 2 && i < len(line) && line[i] == multi[0]; n++ {
+				i++
+			}
+			multi = ""
+			continue
+		}
+
+		switch c := line[i]; c {
+		case '#':
+			return multi, depth, i
+		case '"', '\'':
+			if strings.HasPrefix(line[i:], strings.Repeat(string(c), 3)) {
+				multi = strings.Repeat(string(c), 3)
+				i += 3
+				continue
+			}
+			j := i + 1
+			for ; j < len(line) && line[j] != c && line[j] != '\n'; j++ {
+				if c == '"' && line[j] == '\\' {
+					j++
+				}
+			}
+			i = j + 1
+		case '[', '{':
+			depth++
+			i++
+		case ']', '}':
+			depth--
+			i++
+		default:
+			i++
+		}
+	}
+	return multi, depth, len(line)
+}
+
+// escaped reports if the character at position i is escaped with a backslash.
+func escaped(s string, i int) bool {
+	n := 0
+	for i--; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// stringEnd gets the position of the closing quote of the single-line string
+// at the start of s, or -1.
+func stringEnd(s string) int {
+	if len(s) < 2 || (s[0] != '"' && s[0] != '\'') || strings.HasPrefix(s, `""`) || strings.HasPrefix(s, `''`) {
+		return -1
+	}
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[0] == '"' && s[i] == '\\':
+			i++
+		case s[i] == s[0]:
+			return i
+		case s[i] == '\n':
+			return -1
+		}
+	}
+	return -1
+}
+
+var (
+	reDecimal  = regexp.MustCompile(`^[+-]?[0-9][0-9_]*(\.[0-9_]+)?([eE][+-]?[0-9_]+)?$`)
+	reDatetime = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}`)
+	reTime     = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2}[Tt ])?[0-9]{2}:[0-9]{2}`)
+	reBareKey  = regexp.MustCompile(`^[A-Za-z0-9_-]{2,}`)
+)
+
+// mutation modifies a document to make it invalid.
+type mutation struct {
+	name  string
+	apply func(rnd *rand.Rand, d scannedDoc) (string, bool)
+}
+
+var mutations = []mutation{
+	{"duplicate-key", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' })
+		if !ok {
+			return "", false
+		}
+		return d.replace(k.line, func(s string) string { return k.key + " = 1\n" + s }), true
+	}},
+	{"redefine-table", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		h, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 't' })
+		if !ok {
+			return "", false
+		}
+		return d.String() + "\n[" + h.key + "]\n", true
+	}},
+	{"table-array-conflict", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		h, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 't' || l.kind == 'a' })
+		if !ok {
+			return "", false
+		}
+		if h.kind == 't' {
+			return d.String() + "\n[[" + h.key + "]]\n", true
+		}
+		return d.String() + "\n[" + h.key + "]\n", true
+	}},
+	{"unclosed-header", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		h, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 't' })
+		if !ok {
+			return "", false
+		}
+		return d.replace(h.line, func(s string) string {
+			i := strings.Index(s, "[")
+			return s[:i] + "[" + h.key + "\n"
+		}), true
+	}},
+	{"unclosed-string", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' && stringEnd(l.value) > 0 })
+		if !ok {
+			return "", false
+		}
+		return d.replace(k.line, func(s string) string {
+			e := k.valueAt + stringEnd(k.value)
+			return s[:e] + s[e+1:]
+		}), true
+	}},
+	{"control-char", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		c := string(rune([]byte{0x00, 0x01, 0x08, 0x0b, 0x0c, 0x1b, 0x1f, 0x7f}[rnd.Intn(8)]))
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' && stringEnd(l.value) > 0 })
+		if !ok || rnd.Intn(3) == 0 { // Add to comment.
+			if len(d.lines) == 0 {
+				return "", false
+			}
+			n := rnd.Intn(len(d.lines))
+			return d.replace(n, func(s string) string {
+				return strings.TrimRight(s, "\r\n") + " # comment" + c + "\n"
+			}), true
+		}
+		return d.replace(k.line, func(s string) string {
+			return s[:k.valueAt+1] + c + s[k.valueAt+1:]
+		}), true
+	}},
+	{"bad-escape", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' && stringEnd(l.value) > 0 && l.value[0] == '"' })
+		if !ok {
+			return "", false
+		}
+		esc := []string{`\q`, `\a`, `\ `, `\'`, `\uD800`, `\U00110000`, `\u12`, `\U1234`}[rnd.Intn(8)]
+		return d.replace(k.line, func(s string) string {
+			return s[:k.valueAt+1] + esc + s[k.valueAt+1:]
+		}), true
+	}},
+	{"bad-underscore", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' && reDecimal.MatchString(l.value) })
+		if !ok {
+			return "", false
+		}
+		return d.replace(k.line, func(s string) string {
+			v := k.value
+			switch dot := strings.IndexByte(v, '.'); {
+			case dot > -1 && rnd.Intn(2) == 0:
+				v = v[:dot] + "_" + v[dot:]
+			case dot > -1:
+				v = v[:dot+1] + "_" + v[dot+1:]
+			case rnd.Intn(2) == 0:
+				v += "_"
+			default:
+				v = strings.TrimLeft(v, "+-")
+				v = k.value[:len(k.value)-len(v)] + v[:1] + "__" + v[1:]
+			}
+			return s[:k.valueAt] + v + s[k.valueAt+len(k.value):]
+		}), true
+	}},
+	{"leading-zero", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' && reDecimal.MatchString(l.value) })
+		if !ok {
+			return "", false
+		}
+		return d.replace(k.line, func(s string) string {
+			v := k.value
+			sign := len(v) - len(strings.TrimLeft(v, "+-"))
+			return s[:k.valueAt+sign] + "0" + s[k.valueAt+sign:]
+		}), true
+	}},
+	{"bad-datetime", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' && reTime.MatchString(l.value) })
+		if !ok {
+			return "", false
+		}
+		return d.replace(k.line, func(s string) string {
+			v := []byte(k.value)
+			if reDatetime.MatchString(k.value) {
+				switch rnd.Intn(3) {
+				case 0:
+					copy(v[5:], "13") // Month
+				case 1:
+					copy(v[8:], "32") // Day
+				default:
+					copy(v[8:], "00")
+				}
+			} else {
+				copy(v, "25") // Hour
+			}
+			return s[:k.valueAt] + string(v) + s[k.valueAt+len(v):]
+		}), true
+	}},
+	{"missing-value", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' && l.oneLine })
+		if !ok {
+			return "", false
+		}
+		return d.replace(k.line, func(s string) string {
+			return s[:k.valueAt] + s[k.valueAt+len(k.value):]
+		}), true
+	}},
+	{"missing-equals", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' })
+		if !ok {
+			return "", false
+		}
+		return d.replace(k.line, func(s string) string {
+			eq := keyEnd(s)
+			return s[:eq] + " " + s[eq+1:]
+		}), true
+	}},
+	{"space-in-key", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' && reBareKey.MatchString(l.key) })
+		if !ok {
+			return "", false
+		}
+		return d.replace(k.line, func(s string) string {
+			i := strings.Index(s, k.key) + 1
+			return s[:i] + " " + s[i:]
+		}), true
+	}},
+	{"trailing-dot-key", func(rnd *rand.Rand, d scannedDoc) (string, bool) {
+		k, ok := d.pick(rnd, func(l docLine) bool { return l.kind == 'k' })
+		if !ok {
+			return "", false
+		}
+		return d.replace(k.line, func(s string) string {
+			i := strings.Index(s, k.key) + len(k.key)
+			return s[:i] + "." + s[i:]
+		}), true
+	}},
+}
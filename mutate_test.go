@@ -0,0 +1,131 @@
+package tomltest
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestMutations(t *testing.T) {
+	docs, err := NewRunner(Runner{}).BenchDocs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mutations {
+		t.Run(m.name, func(t *testing.T) {
+			var applied, rej int
+			for i, d := range docs {
+				mut, ok := m.apply(rand.New(rand.NewSource(int64(i))), scanDoc(d.TOML))
+				if !ok {
+					continue
+				}
+				applied++
+				if rejected(mut) {
+					rej++
+				}
+			}
+			// Not every mutation is guaranteed to make a document invalid, but
+			// it should for most documents.
+			if applied == 0 || rej < applied*9/10 {
+				t.Errorf("applied to %d documents; %d rejected", applied, rej)
+			}
+		})
+	}
+}
+
+func TestScanDoc(t *testing.T) {
+	d := scanDoc(`# [comment]
+a = "x # y" # comment
+[tbl]
+arr = [
+	"""
+b = 1
+""", # c = 2
+]
+"q.=" . k = { x = 1 }
+[[ aot ]]
+`)
+	want := []docLine{
+		{line: 1, kind: 'k', key: "a", value: `"x # y"`, valueAt: 4, oneLine: true},
+		{line: 2, kind: 't', key: "tbl"},
+		{line: 3, kind: 'k', key: "arr", value: "[", valueAt: 6},
+		{line: 8, kind: 'k', key: `"q.=" . k`, value: "{ x = 1 }", valueAt: 12, oneLine: true},
+		{line: 9, kind: 'a', key: "aot"},
+	}
+	if len(d.found) != len(want) {
+		t.Fatalf("\nhave: %#v\nwant: %#v", d.found, want)
+	}
+	for i := range want {
+		if d.found[i] != want[i] {
+			t.Errorf("\nhave: %#v\nwant: %#v", d.found[i], want[i])
+		}
+	}
+}
+
+func TestFuzzInvalid(t *testing.T) {
+	docs, err := NewRunner(Runner{RunTests: []string{"valid/key/*", "valid/string/*"}}).BenchDocs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRunner(Runner{Decoder: FuncParser{Decode: tomlDecode}})
+	for seed := int64(0); seed < 10; seed++ {
+		tt, err := r.FuzzInvalid(context.Background(), docs, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.Failed() || tt.Outcome != OutcomePassed || !strings.HasPrefix(tt.Path, "invalid/fuzz/") {
+			t.Fatalf("%s: %s; %s", tt.Path, tt.Outcome, tt.Failure)
+		}
+	}
+
+	// Accepts everything.
+	r.Decoder = FuncParser{Decode: func(ctx context.Context, data []byte) (any, error) {
+		return map[string]any{}, nil
+	}}
+	tt, err := r.FuzzInvalid(context.Background(), docs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tt.Failed() || !strings.Contains(tt.Failure, "minimized from") {
+		t.Fatalf("%s: %s; %s", tt.Path, tt.Outcome, tt.Failure)
+	}
+	if len(tt.RejectExitCodes) != 1 || tt.RejectExitCodes[0] != 1 {
+		t.Errorf("RejectExitCodes not set: %v", tt.RejectExitCodes)
+	}
+	if !rejected(tt.Input) || len(tt.Input) > 20 {
+		t.Errorf("not minimized: %q", tt.Input)
+	}
+
+	// Cancelled while minimizing.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var n int
+	r.Decoder = FuncParser{Decode: func(_ context.Context, data []byte) (any, error) {
+		if n++; n > 1 {
+			cancel()
+		}
+		return map[string]any{}, nil
+	}}
+	tt, err = r.FuzzInvalid(ctx, docs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tt.Failed() || strings.Contains(tt.Failure, "minimized from") || !strings.Contains(tt.Failure, "Mutated from") {
+		t.Errorf("%s: %s; %s", tt.Path, tt.Outcome, tt.Failure)
+	}
+
+	tt, err = r.FuzzInvalid(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tt.Skipped {
+		t.Errorf("not skipped: %#v", tt)
+	}
+
+	r.Env = []string{"NOVALUE"}
+	if _, err := r.FuzzInvalid(context.Background(), docs, 1); !errorContains(err, `invalid Env: "NOVALUE"`) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
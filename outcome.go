@@ -0,0 +1,57 @@
+package tomltest
+
+import "fmt"
+
+// Outcome of a test.
+type Outcome uint8
+
+const (
+	// Test wasn't run.
+	OutcomeNone Outcome = iota
+
+	// Test passed: a valid or encoder test gave the correct output, or the
+	// parser exited with the rejection exit code for an invalid test.
+	OutcomePassed
+
+	// Test failed: the output was wrong, an invalid test wasn't rejected, or
+	// the error didn't match.
+	OutcomeFailed
+
+	// A valid or encoder test was rejected by the parser.
+	OutcomeRejected
+
+	// The parser crashed: it was stopped by a signal, exited with an exit code
+	// other than 0 or the rejection exit code, or couldn't be run at all.
+	OutcomeCrashed
+
+	// The parser didn't finish before the timeout.
+	OutcomeTimedOut
+
+	// Test was skipped.
+	OutcomeSkipped
+
+	// An invalid test was rejected, but the error was reported at a different
+	// position than expected, or no position was found in the output.
+	OutcomeWrongPosition
+)
+
+var outcomes = []string{"", "passed", "failed", "rejected", "crashed", "timed-out", "skipped", "wrong-position"}
+
+func (o Outcome) String() string {
+	if int(o) >= len(outcomes) {
+		return fmt.Sprintf("Outcome(%d)", o)
+	}
+	return outcomes[o]
+}
+
+func (o Outcome) MarshalText() ([]byte, error) { return []byte(o.String()), nil }
+
+func (o *Outcome) UnmarshalText(text []byte) error {
+	for i, oo := range outcomes {
+		if oo == string(text) {
+			*o = Outcome(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown outcome: %q", text)
+}
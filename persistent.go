@@ -0,0 +1,250 @@
+package tomltest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PersistentParser starts an external command once and sends it many test
+// inputs, rather than starting a new process for every test.
+//
+// The command reads frames from stdin and writes frames to stdout; every frame
+// is a header line followed by exactly that many bytes of data:
+//
+//	Runner → command:   <length>\n<data>
+//	Command → runner:   ok <length>\n<data>
+//	                    error <length>\n<data>
+//
+// The length is the number of bytes in data as a decimal number. "ok" is used
+// for successful runs and data is the JSON description (decoder) or TOML
+// (encoder). "error" is used if the input was rejected, and data is the error
+// message. The command should exit once stdin is closed.
+//
+// Up to n commands are run at the same time. Commands that crash, write
+// malformed frames, or time out are killed and restarted on the next test.
+//
+// The command is started with the environment from the Invocation of the first
+// test it's used for, without TOML_TEST_NAME and TOML_TEST_TYPE.
+type PersistentParser struct {
+	cmd  []string
+	pool chan *worker
+}
+
+// NewPersistentParser creates a new PersistentParser which runs up to n
+// instances of cmd.
+func NewPersistentParser(cmd []string, n int) *PersistentParser {
+	if n < 1 {
+		n = 1
+	}
+	p := &PersistentParser{cmd: cmd, pool: make(chan *worker, n)}
+	for i := 0; i < n; i++ {
+		p.pool <- nil // Started on first use.
+	}
+	return p
+}
+
+func (p *PersistentParser) Cmd() []string { return p.cmd }
+
+func (p *PersistentParser) Run(ctx context.Context, input string) (pid int, output string, outputIsError bool, err error) {
+	var w *worker
+	select {
+	case w = <-p.pool:
+	case <-ctx.Done():
+		return 0, "", false, ctx.Err()
+	}
+
+	if w != nil {
+		select {
+		case <-w.done: // Exited after the last test; just start a new one.
+			w = nil
+		default:
+		}
+	}
+	if w == nil {
+		var env []string
+		if inv, ok := InvocationFromContext(ctx); ok {
+			inv.Name, inv.Type = "", ""
+			env = inv.Environ()
+		}
+		w, err = startWorker(p.cmd, env)
+		if err != nil {
+			p.pool <- nil
+			return 0, "", false, err
+		}
+	}
+	pid = w.cmd.Process.Pid
+
+	type result struct {
+		ok   bool
+		data []byte
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		ok, data, err := w.send(input)
+		ch <- result{ok, data, err}
+	}()
+
+	var res result
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		w.kill()
+		<-ch
+		p.pool <- nil
+		return pid, "", false, ctx.Err()
+	}
+	if res.err != nil {
+		w.kill()
+		p.pool <- nil
+		return pid, "", false, res.err
+	}
+
+	p.pool <- w
+	return pid, strings.TrimSpace(string(res.data)) + "\n", !res.ok, nil
+}
+
+// Close stops all running commands.
+func (p *PersistentParser) Close() error {
+	for i := 0; i < cap(p.pool); i++ {
+		if w := <-p.pool; w != nil {
+			w.close()
+		}
+	}
+	for i := 0; i < cap(p.pool); i++ {
+		p.pool <- nil
+	}
+	return nil
+}
+
+type worker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	pipe   *io.PipeReader
+	stderr *lockedBuffer
+	done   chan struct{}
+}
+
+func startWorker(cmdline, env []string) (*worker, error) {
+	w := &worker{
+		cmd:    exec.Command(cmdline[0]),
+		stderr: new(lockedBuffer),
+		done:   make(chan struct{}),
+	}
+	w.cmd.Args, w.cmd.Env = cmdline, env
+	w.cmd.Stderr = w.stderr
+
+	// Don't use StdoutPipe(), as Wait() closes that as soon as the process
+	// exits, possibly before we read all the data it wrote.
+	pr, pw := io.Pipe()
+	w.pipe, w.stdout, w.cmd.Stdout = pr, bufio.NewReader(pr), pw
+
+	var err error
+	w.stdin, err = w.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		w.cmd.Wait()
+		pw.Close()
+		close(w.done)
+	}()
+	return w, nil
+}
+
+// send a single frame and read the response.
+func (w *worker) send(input string) (bool, []byte, error) {
+	w.stderr.Reset()
+
+	_, err := fmt.Fprintf(w.stdin, "%d\n%s", len(input), input)
+	if err != nil {
+		return false, nil, w.exitErr(err)
+	}
+
+	header, err := w.stdout.ReadString('\n')
+	if err != nil {
+		return false, nil, w.exitErr(err)
+	}
+	status, l, _ := strings.Cut(strings.TrimSuffix(header, "\n"), " ")
+	if status != "ok" && status != "error" {
+		return false, nil, fmt.Errorf("persistent parser: malformed frame header %q: status must be \"ok\" or \"error\"", header)
+	}
+	n, err := strconv.Atoi(l)
+	if err != nil || n < 0 {
+		return false, nil, fmt.Errorf("persistent parser: malformed frame header %q: invalid length", header)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(w.stdout, data); err != nil {
+		return false, nil, w.exitErr(err)
+	}
+	return status == "ok", data, nil
+}
+
+// exitErr creates an error for a command that stopped responding, including
+// anything it wrote to stderr.
+func (w *worker) exitErr(err error) error {
+	select {
+	case <-w.done:
+		err = fmt.Errorf("persistent parser exited unexpectedly: %s", w.cmd.ProcessState)
+	case <-time.After(100 * time.Millisecond):
+		err = fmt.Errorf("persistent parser: %w", err)
+	}
+	if s := strings.TrimSpace(w.stderr.String()); s != "" {
+		err = fmt.Errorf("%w; stderr:\n%s", err, s)
+	}
+	return err
+}
+
+func (w *worker) kill() {
+	w.cmd.Process.Kill()
+	w.pipe.Close()
+	<-w.done
+}
+
+// close stdin and wait for the command to exit, killing it if it doesn't exit
+// in a reasonable amount of time.
+func (w *worker) close() {
+	w.stdin.Close()
+	select {
+	case <-w.done:
+	case <-time.After(time.Second):
+		w.kill()
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that's safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
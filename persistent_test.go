@@ -0,0 +1,96 @@
+package tomltest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestPersistentHelper isn't a real test, but a persistent parser started from
+// TestPersistent.
+func TestPersistentHelper(t *testing.T) {
+	if os.Getenv("TOMLTEST_PERSISTENT_HELPER") != "1" {
+		return
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		l, err := in.ReadString('\n')
+		if err == io.EOF {
+			os.Exit(0)
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(l))
+		data := make([]byte, n)
+		io.ReadFull(in, data)
+
+		status, out := "ok", ""
+		switch string(data) {
+		case `a=1`:
+			out = `{"a": {"type":"integer","value":"1"}}`
+		case `crash=`:
+			fmt.Fprintln(os.Stderr, "oh noes")
+			os.Exit(2)
+		case `hang=`:
+			time.Sleep(time.Minute)
+		default:
+			status, out = "error", "error one"
+		}
+		fmt.Printf("%s %d\n%s", status, len(out), out)
+	}
+}
+
+func TestPersistent(t *testing.T) {
+	t.Setenv("TOMLTEST_PERSISTENT_HELPER", "1")
+
+	p := NewPersistentParser([]string{os.Args[0], "-test.run=^TestPersistentHelper$"}, 2)
+	defer p.Close()
+
+	r := NewRunner(Runner{
+		Decoder:  p,
+		Parallel: 2,
+		Timeout:  500 * time.Millisecond,
+		Files: fstest.MapFS{
+			"valid/a.toml":     &fstest.MapFile{Data: []byte(`a=1`)},
+			"valid/a.json":     &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"valid/b.toml":     &fstest.MapFile{Data: []byte(`a=1`)},
+			"valid/b.json":     &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"invalid/a.toml":   &fstest.MapFile{Data: []byte(`a=`)},
+			"invalid/b.toml":   &fstest.MapFile{Data: []byte(`b=`)},
+			"invalid/c.toml":   &fstest.MapFile{Data: []byte(`crash=`)},
+			"invalid/d.toml":   &fstest.MapFile{Data: []byte(`hang=`)},
+			"invalid/e.toml":   &fstest.MapFile{Data: []byte(`e=`)},
+			"invalid/f/a.toml": &fstest.MapFile{Data: []byte(`f=`)},
+		},
+	})
+	tests, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests.Tests {
+		switch test.Path {
+		case "invalid/c":
+			if !strings.Contains(test.Failure, "exited unexpectedly") || !strings.Contains(test.Failure, "oh noes") {
+				t.Errorf("wrong failure for %q: %q", test.Path, test.Failure)
+			}
+		case "invalid/d":
+			if !strings.Contains(test.Failure, "timed out") {
+				t.Errorf("wrong failure for %q: %q", test.Path, test.Failure)
+			}
+		default:
+			if test.Failed() {
+				t.Errorf("%s: %s", test.Path, test.Failure)
+			}
+		}
+	}
+	if tests.PassedValid != 2 || tests.PassedInvalid != 4 || tests.FailedInvalid != 2 {
+		t.Errorf("PassedValid=%d; PassedInvalid=%d; FailedInvalid=%d",
+			tests.PassedValid, tests.PassedInvalid, tests.FailedInvalid)
+	}
+}
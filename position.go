@@ -0,0 +1,142 @@
+package tomltest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultErrorPositionRegex are the default regular expressions to find the
+// error position in the decoder's output. This matches "line 3", "line 3,
+// column 5", "(line 3, column 5)", "3:5", and "file.toml:3:5:".
+var DefaultErrorPositionRegex = []string{
+	`(?i)\bline:? *(?P<line>\d+)(?:(?:, *| +)col(?:umn)?:? *(?P<col>\d+))?`,
+	`(?:^|[^\d:]|[^\d]:)(?P<line>\d+):(?P<col>\d+)(?:[^\d:]|:[^\d]|:?$)`,
+}
+
+// Position of an error in an invalid test.
+//
+// Lines and columns start at 1; Column is 0 if only the line is known. Columns
+// are counted in characters, not bytes.
+type Position struct {
+	Line, Column int
+}
+
+func (p Position) String() string {
+	if p.Column == 0 {
+		return fmt.Sprintf("line %d", p.Line)
+	}
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+// ParsePosition parses a position as "line" or "line:column".
+func ParsePosition(s string) (Position, error) {
+	l, c, hasCol := strings.Cut(strings.TrimSpace(s), ":")
+	var (
+		p   Position
+		err error
+	)
+	p.Line, err = strconv.Atoi(l)
+	if err != nil || p.Line < 1 {
+		return Position{}, fmt.Errorf("invalid position %q: line must be a number larger than 0", s)
+	}
+	if hasCol {
+		p.Column, err = strconv.Atoi(c)
+		if err != nil || p.Column < 1 {
+			return Position{}, fmt.Errorf("invalid position %q: column must be a number larger than 0", s)
+		}
+	}
+	return p, nil
+}
+
+// matches reports if have is the same position as p; the column is only
+// compared if both have one.
+func (p Position) matches(have Position) bool {
+	return p.Line == have.Line && (p.Column == 0 || have.Column == 0 || p.Column == have.Column)
+}
+
+var reHeaderPosition = regexp.MustCompile(`^#\s*error-position:\s*(\S+)`)
+
+// ReadPosition reads the expected error position for an invalid test, from
+// either a "[test].position" file or an "# error-position: 3:5" comment on the
+// first line of the test. ok is false if the test doesn't have a position.
+//
+// Tests in .multi files and variants never have a position.
+func (t Test) ReadPosition(fsys fs.FS) (p Position, ok bool, err error) {
+	if !t.Invalid() || t.Variant() != "" || strings.Contains(t.Path, "#") {
+		return Position{}, false, nil
+	}
+
+	path := t.basePath() + ".position"
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Position{}, false, err
+	}
+	if err != nil {
+		path, data, err := t.readFile(fsys, false)
+		if err != nil {
+			return Position{}, false, err
+		}
+		first, _, _ := strings.Cut(data, "\n")
+		m := reHeaderPosition.FindStringSubmatch(first)
+		if m == nil {
+			return Position{}, false, nil
+		}
+		p, err := ParsePosition(m[1])
+		if err != nil {
+			return Position{}, false, fmt.Errorf("%s: %w", path, err)
+		}
+		return p, true, nil
+	}
+
+	p, err = ParsePosition(string(data))
+	if err != nil {
+		return Position{}, false, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, true, nil
+}
+
+// findPosition finds the first error position in the output with the regular
+// expressions in order.
+func findPosition(output string, re []*regexp.Regexp) (Position, bool) {
+	for _, r := range re {
+		m := r.FindStringSubmatch(output)
+		if m == nil {
+			continue
+		}
+		var p Position
+		if i := r.SubexpIndex("line"); i > -1 {
+			p.Line, _ = strconv.Atoi(m[i])
+		}
+		if i := r.SubexpIndex("col"); i > -1 {
+			p.Column, _ = strconv.Atoi(m[i])
+		}
+		if p.Line > 0 {
+			return p, true
+		}
+	}
+	return Position{}, false
+}
+
+// compilePositionRegex compiles the regular expressions for
+// Runner.ErrorPositionRegex.
+func compilePositionRegex(exprs []string) ([]*regexp.Regexp, error) {
+	if len(exprs) == 0 {
+		exprs = DefaultErrorPositionRegex
+	}
+	re := make([]*regexp.Regexp, 0, len(exprs))
+	for _, e := range exprs {
+		r, err := regexp.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ErrorPositionRegex: %w", err)
+		}
+		if r.SubexpIndex("line") == -1 {
+			return nil, fmt.Errorf("invalid ErrorPositionRegex %q: must have a (?P<line>..) group", e)
+		}
+		re = append(re, r)
+	}
+	return re, nil
+}
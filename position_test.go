@@ -0,0 +1,88 @@
+package tomltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFindPosition(t *testing.T) {
+	re, err := compilePositionRegex(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`toml: line 4: Key 'a' has already been defined.`, "line 4"},
+		{`toml: line 2 (last key "d"): invalid datetime: "2006-01-01T24:00:00-00:00"`, "line 2"},
+		{`Cannot declare ('a',) twice (at line 4, column 3)`, "line 4, column 3"},
+		{`Line 3 Column 5: unexpected character`, "line 3, column 5"},
+		{`error: 3:5: unexpected character`, "line 3, column 5"},
+		{`<stdin>:3:5: unexpected character`, "line 3, column 5"},
+		{`file.toml:12:1`, "line 12, column 1"},
+		{`invalid time "07:32:00"`, ""},
+		{`invalid datetime 1979-05-27T07:32:00`, ""},
+		{`syntax error`, ""},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have, ok := findPosition(tt.in, re)
+			if !ok {
+				if tt.want != "" {
+					t.Errorf("no position in %q; want %s", tt.in, tt.want)
+				}
+				return
+			}
+			if have.String() != tt.want {
+				t.Errorf("%q\nhave: %s\nwant: %s", tt.in, have, tt.want)
+			}
+		})
+	}
+
+	if _, err := compilePositionRegex([]string{`line (\d+)`}); err == nil {
+		t.Error("no error without line group")
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	var (
+		dec = func(msg string) FuncParser {
+			return FuncParser{Decode: func(ctx context.Context, data []byte) (any, error) {
+				return nil, errors.New(msg)
+			}}
+		}
+		files = fstest.MapFS{
+			"invalid/a.toml":     &fstest.MapFile{Data: []byte("a = 1\na = 2\n")},
+			"invalid/a.position": &fstest.MapFile{Data: []byte("2\n")},
+			"invalid/b.toml":     &fstest.MapFile{Data: []byte("# error-position: 3:1\nb = 1\nb = 2\n")},
+			"invalid/c.toml":     &fstest.MapFile{Data: []byte("c = \n")},
+		}
+	)
+
+	tests, err := NewRunner(Runner{Decoder: dec("line 2, column 5"), Files: files}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests.PassedInvalid != 2 || tests.FailedInvalid != 1 || tests.WrongPosition != 1 {
+		t.Errorf("wrong counts: %#v", tests)
+	}
+	if o := tests.Tests[1].Outcome; o != OutcomeWrongPosition {
+		t.Errorf("outcome %s for %s: %s", o, tests.Tests[1].Path, tests.Tests[1].Failure)
+	}
+
+	tests, err = NewRunner(Runner{Decoder: dec("oops"), Files: files, ErrorPositionWarn: true}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests.PassedInvalid != 3 || tests.WrongPosition != 2 {
+		t.Errorf("wrong counts: %#v", tests)
+	}
+	for _, test := range tests.Tests {
+		if w := len(test.Warnings); (test.Path == "invalid/c" && w != 0) || (test.Path != "invalid/c" && w != 1) {
+			t.Errorf("%s: wrong warnings: %q", test.Path, test.Warnings)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package tomltest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing/fstest"
+)
+
+// Reduce runs the test at path with the decoder, and if it fails finds the
+// smallest input that still fails in the same way.
+//
+// It fails in the same way if the Outcome is the same, and for failed tests if
+// the Key and type of failure from CompareJSON are the same. Input for valid
+// tests is kept as valid TOML, and input for invalid tests is kept invalid,
+// according to BurntSushi/toml; tests that BurntSushi/toml doesn't pass can't
+// be reduced. The Want of the returned Test is set to the JSON description of
+// the reduced input for valid tests.
+//
+// The reduced Test is the same as the original if the original didn't fail.
+// Encoder and encoder-invalid tests can't be reduced.
+func (r Runner) Reduce(ctx context.Context, path string) (orig, reduced Test, err error) {
+	if _, err := r.prepare(); err != nil {
+		return Test{}, Test{}, fmt.Errorf("tomltest.Runner.Reduce: %w", err)
+	}
+	list, err := r.List()
+	if err != nil {
+		return Test{}, Test{}, fmt.Errorf("tomltest.Runner.Reduce: %w", err)
+	}
+	if !slicesContains(list, path) {
+		return Test{}, Test{}, fmt.Errorf("tomltest.Runner.Reduce: no test %q for TOML %s", path, r.Version)
+	}
+
+	orig = r.newTest(path)
+	if orig.Encoder() || orig.EncoderInvalid() {
+		return Test{}, Test{}, fmt.Errorf("tomltest.Runner.Reduce: can't reduce encoder test %q", path)
+	}
+	_, in, err := orig.ReadInput(r.Files)
+	if err != nil {
+		return Test{}, Test{}, fmt.Errorf("tomltest.Runner.Reduce: %w", err)
+	}
+	if orig.Invalid() && !rejected(in) {
+		return Test{}, Test{}, fmt.Errorf("tomltest.Runner.Reduce: %s: BurntSushi/toml accepts this test, so it can't be reduced", path)
+	}
+	if !orig.Invalid() {
+		_, want, err := orig.ReadWant(r.Files)
+		if err != nil {
+			return Test{}, Test{}, fmt.Errorf("tomltest.Runner.Reduce: %w", err)
+		}
+		if err := sameJSON(in, want); err != nil {
+			return Test{}, Test{}, fmt.Errorf("tomltest.Runner.Reduce: %s: %w", path, err)
+		}
+	}
+
+	orig = orig.RunContext(ctx, r.Decoder, r.Files)
+	if !orig.Failed() || ctx.Err() != nil {
+		return orig, orig, ctx.Err()
+	}
+
+	var (
+		class = failureClass(orig)
+		tried = make(map[string]Test)
+	)
+	run := func(input string) (Test, bool) {
+		if t, ok := tried[input]; ok {
+			return t, true
+		}
+		t := r.runReduced(ctx, orig, input)
+		if ctx.Err() != nil {
+			return t, false
+		}
+		tried[input] = t
+		return t, true
+	}
+	small := reduceText(orig.Input, func(s string) bool {
+		t, ok := run(s)
+		return ok && t.Path != "" && failureClass(t) == class
+	})
+	if ctx.Err() != nil {
+		return orig, orig, ctx.Err()
+	}
+	reduced, _ = run(small)
+	return orig, reduced, nil
+}
+
+// runReduced runs the reduced input for test t. The returned Test has a blank
+// Path if the input is valid for invalid tests or invalid for valid tests.
+func (r Runner) runReduced(ctx context.Context, t Test, input string) Test {
+	var (
+		name = t.Type().String() + "/reduce"
+		fsys = fstest.MapFS{name + ".toml": &fstest.MapFile{Data: []byte(input)}}
+		want string
+	)
+	if t.Invalid() {
+		if !rejected(input) {
+			return Test{}
+		}
+	} else {
+		j, err := referenceJSON(input)
+		if err != nil {
+			return Test{}
+		}
+		fsys[name+".json"], want = &fstest.MapFile{Data: []byte(j)}, j
+	}
+
+	rt := r.newTest(name).RunContext(ctx, r.Decoder, fsys)
+	rt.Path, rt.Want = t.Path, want
+	return rt
+}
+
+var reQuoted = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// failureClass gets the type of failure, ignoring details that may change when
+// the input is reduced, such as values and error messages.
+func failureClass(t Test) string {
+	if t.Outcome != OutcomeFailed {
+		return t.Outcome.String()
+	}
+	first, _, _ := strings.Cut(t.Failure, "\n")
+	return t.Key + "\x00" + reQuoted.ReplaceAllString(first, `""`)
+}
+
+// sameJSON checks that the JSON description from BurntSushi/toml is the same as
+// want, as that's used for the JSON description of reduced valid tests.
+func sameJSON(doc, want string) error {
+	have, err := referenceJSON(doc)
+	if err != nil {
+		return err
+	}
+	var h, w any
+	if err := json.Unmarshal([]byte(have), &h); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		return err
+	}
+	if t := (Test{}).CompareJSON(w, h); t.Failed() {
+		return fmt.Errorf("BurntSushi/toml doesn't decode this test correctly, so it can't be reduced:\n%s", t.Failure)
+	}
+	return nil
+}
+
+// reduceText finds the smallest text for which keep still returns true, by
+// removing key/value pairs and table headers, lines, and characters. keep(s)
+// must be true.
+func reduceText(s string, keep func(string) bool) string {
+	join := func(parts []string) bool { return keep(strings.Join(parts, "")) }
+	for {
+		l := len(s)
+		s = strings.Join(ddmin(splitKeys(s), join), "")
+		s = strings.Join(ddmin(strings.SplitAfter(s, "\n"), join), "")
+
+		chars := make([]string, 0, len(s))
+		for _, c := range s {
+			chars = append(chars, string(c))
+		}
+		s = strings.Join(ddmin(chars, join), "")
+		if len(s) == l {
+			return s
+		}
+	}
+}
+
+// splitKeys splits a document in key/value pairs and table headers, each with
+// all lines up to the next key/value pair or table header.
+func splitKeys(s string) []string {
+	d := scanDoc(s)
+	if len(d.found) == 0 {
+		return []string{s}
+	}
+	parts := make([]string, 0, len(d.found)+1)
+	if d.found[0].line > 0 {
+		parts = append(parts, strings.Join(d.lines[:d.found[0].line], ""))
+	}
+	for i, f := range d.found {
+		end := len(d.lines)
+		if i+1 < len(d.found) {
+			end = d.found[i+1].line
+		}
+		parts = append(parts, strings.Join(d.lines[f.line:end], ""))
+	}
+	return parts
+}
+
+// ddmin finds the smallest list of parts for which keep still returns true,
+// with the delta debugging algorithm. keep(parts) must be true.
+func ddmin[T any](parts []T, keep func([]T) bool) []T {
+	if len(parts) > 0 && keep(parts[:0]) {
+		return parts[:0]
+	}
+	n := 2
+	for len(parts) >= 2 {
+		var (
+			chunk   = (len(parts) + n - 1) / n
+			reduced = false
+		)
+		for i := 0; i < len(parts); i += chunk {
+			end := i + chunk
+			if end > len(parts) {
+				end = len(parts)
+			}
+			c := append(append(make([]T, 0, len(parts)-(end-i)), parts[:i]...), parts[end:]...)
+			if keep(c) {
+				parts, reduced = c, true
+				if n--; n < 2 {
+					n = 2
+				}
+				break
+			}
+		}
+		if !reduced {
+			if n >= len(parts) {
+				break
+			}
+			if n *= 2; n > len(parts) {
+				n = len(parts)
+			}
+		}
+	}
+	return parts
+}
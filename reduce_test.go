@@ -0,0 +1,82 @@
+package tomltest
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReduceText(t *testing.T) {
+	tests := []struct {
+		in, want string
+		keep     func(string) bool
+	}{
+		{"a = 1\nb = 2\nc = 3\n", "b", func(s string) bool { return strings.Contains(s, "b") }},
+		{"a = 1\nb = 2\nc = 3\n", "a2", func(s string) bool { return strings.Contains(s, "a") && strings.Contains(s, "2") }},
+		{"xxx", "xxx", func(s string) bool { return s == "xxx" }},
+		{"€ ü", "€ü", func(s string) bool { return strings.Contains(s, "€") && strings.Contains(s, "ü") }},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have := reduceText(tt.in, tt.keep)
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestReduce(t *testing.T) {
+	// Adds 1 to all integers.
+	r := NewRunner(Runner{Decoder: FuncParser{Decode: func(ctx context.Context, data []byte) (any, error) {
+		v, err := tomlDecode(ctx, data)
+		var inc func(v any) any
+		inc = func(v any) any {
+			switch vv := v.(type) {
+			case int64:
+				return vv + 1
+			case []any:
+				for i := range vv {
+					vv[i] = inc(vv[i])
+				}
+			case map[string]any:
+				for k := range vv {
+					vv[k] = inc(vv[k])
+				}
+			}
+			return v
+		}
+		return inc(v), err
+	}}})
+
+	orig, reduced, err := r.Reduce(context.Background(), "valid/example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !orig.Failed() || !reduced.Failed() || failureClass(orig) != failureClass(reduced) {
+		t.Fatalf("\norig:    %s\nreduced: %s", orig.Failure, reduced.Failure)
+	}
+	if reduced.Path != "valid/example" || reduced.Want == "" || rejected(reduced.Input) {
+		t.Errorf("%#v", reduced)
+	}
+	if want := "[numtheory]\nperfection=[6]"; reduced.Input != want {
+		t.Errorf("\nhave: %q\nwant: %q", reduced.Input, want)
+	}
+
+	// Accepts everything.
+	r.Decoder = FuncParser{Decode: func(ctx context.Context, data []byte) (any, error) {
+		return map[string]any{}, nil
+	}}
+	_, reduced, err = r.Reduce(context.Background(), "invalid/table/duplicate-key-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reduced.Failed() || !rejected(reduced.Input) || len(reduced.Input) > 20 {
+		t.Errorf("%q: %s", reduced.Input, reduced.Failure)
+	}
+
+	_, _, err = r.Reduce(context.Background(), "valid/doesnt-exist")
+	if !errorContains(err, "no test") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package tomltest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ParserV2 is a Parser that returns a Result with detailed information about
+// the run, rather than just the output.
+//
+// Existing Parser implementations keep working: they're converted with
+// AsParserV2.
+type ParserV2 interface {
+	Parser
+
+	// Exec runs the parser command (decoder or encoder).
+	//
+	// An error return should only be used if the command couldn't be run at
+	// all; a non-zero exit code is reported in the Result.
+	Exec(ctx context.Context, input string) (Result, error)
+}
+
+// Result of running a parser.
+type Result struct {
+	PID      int           `json:"pid"`       // PID from test run.
+	Stdout   string        `json:"stdout"`    // Everything written to stdout.
+	Stderr   string        `json:"stderr"`    // Everything written to stderr.
+	ExitCode int           `json:"exit_code"` // Exit code; -1 if stopped by a signal.
+	Signal   string        `json:"signal"`    // Signal that stopped the command, if any.
+	Duration time.Duration `json:"duration"`  // Wall time, in nanoseconds.
+	UserTime time.Duration `json:"user_time"` // User CPU time, in nanoseconds.
+	SysTime  time.Duration `json:"sys_time"`  // System CPU time, in nanoseconds.
+	MaxRSS   int64         `json:"max_rss"`   // Peak resident set size in bytes; 0 if not supported.
+}
+
+// AsParserV2 converts a Parser to a ParserV2.
+//
+// If p already implements ParserV2 it's returned as-is. Otherwise output is
+// reported as Stderr with exit code 1 if outputIsError is set, or as Stdout
+// with exit code 0 if it's not.
+func AsParserV2(p Parser) ParserV2 {
+	if p2, ok := p.(ParserV2); ok {
+		return p2
+	}
+	return parserAdapter{p}
+}
+
+type parserAdapter struct{ Parser }
+
+func (a parserAdapter) Exec(ctx context.Context, input string) (Result, error) {
+	r, _, _, err := a.exec(ctx, input)
+	return r, err
+}
+
+func (a parserAdapter) exec(ctx context.Context, input string) (Result, string, bool, error) {
+	start := time.Now()
+	pid, output, outputIsError, err := a.Run(ctx, input)
+	r := Result{PID: pid, Duration: time.Since(start)}
+	if outputIsError {
+		r.Stderr, r.ExitCode = output, 1
+	} else {
+		r.Stdout = output
+	}
+	return r, output, outputIsError, err
+}
+
+// execParser runs the parser, returning both the Result and the output as
+// Parser.Run would.
+//
+// For a Parser that doesn't implement ParserV2 the exit code is set to the
+// first rejection exit code if it reported an error.
+func execParser(ctx context.Context, p Parser, input string, v validity) (r Result, output string, outputIsError bool, err error) {
+	p2, ok := p.(ParserV2)
+	if !ok {
+		r, output, outputIsError, err = parserAdapter{p}.exec(ctx, input)
+		if outputIsError {
+			r.ExitCode = v.rejectCodes()[0]
+		}
+		return r, output, outputIsError, err
+	}
+	r, err = p2.Exec(ctx, input)
+	if err != nil {
+		return r, "", false, err
+	}
+	output, outputIsError, err = r.output(v)
+	return r, output, outputIsError, err
+}
+
+// setProcessState sets the fields from the ProcessState.
+func (r *Result) setProcessState(ps *os.ProcessState) {
+	r.ExitCode = ps.ExitCode()
+	r.UserTime = ps.UserTime()
+	r.SysTime = ps.SystemTime()
+	r.Signal, r.MaxRSS = sysUsage(ps)
+}
+
+// validity describes how to decide if the parser rejected the input.
+type validity struct {
+	exitCode bool  // Use only the exit code, rather than stderr.
+	reject   []int // Exit codes that mean the input was rejected.
+}
+
+func (v validity) rejectCodes() []int {
+	if len(v.reject) == 0 {
+		return []int{1}
+	}
+	return v.reject
+}
+
+func (v validity) rejected(code int) bool {
+	for _, c := range v.rejectCodes() {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// output gets the output as it was returned by Parser.Run: stderr if it's not
+// empty, or stdout if it is. The rejection exit codes are treated as an error
+// from the parser, and any other non-zero exit code as an error running it.
+//
+// If exitCode is set then only the exit code is used: stdout is returned on
+// success and stderr if the input was rejected.
+func (r Result) output(v validity) (output string, outputIsError bool, err error) {
+	rejected := v.rejected(r.ExitCode)
+	switch {
+	case r.Signal != "":
+		err = fmt.Errorf("signal: %s", r.Signal)
+	case r.ExitCode != 0 && !rejected:
+		err = fmt.Errorf("exit status %d", r.ExitCode)
+	}
+
+	if v.exitCode {
+		if rejected {
+			return strings.TrimSpace(r.Stderr) + "\n", true, err
+		}
+		return strings.TrimSpace(r.Stdout) + "\n", false, err
+	}
+
+	stderr := r.Stderr
+	if rejected {
+		stderr += fmt.Sprintf("\nExit %d\n", r.ExitCode)
+	}
+	if stderr != "" {
+		return strings.TrimSpace(stderr) + "\n", true, err
+	}
+	return strings.TrimSpace(r.Stdout) + "\n", false, err
+}
@@ -0,0 +1,73 @@
+package tomltest
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResult(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	tests := []struct {
+		script      string
+		wantExit    int
+		wantSignal  string
+		wantStdout  string
+		wantStderr  string
+		wantOutput  string
+		wantIsError bool
+		wantErr     string
+	}{
+		{`echo out`, 0, "", "out\n", "", "out\n", false, ""},
+		{`echo err >&2; exit 1`, 1, "", "", "err\n", "err\n\nExit 1\n", true, ""},
+		{`echo out; echo err >&2; exit 3`, 3, "", "out\n", "err\n", "err\n", true, "exit status 3"},
+		{`kill -9 $$`, -1, "killed", "", "", "\n", false, "signal: killed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			p := NewCommandParser([]string{"sh", "-c", tt.script})
+			r, err := p.Exec(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.ExitCode != tt.wantExit || r.Signal != tt.wantSignal || r.Stdout != tt.wantStdout || r.Stderr != tt.wantStderr {
+				t.Errorf("\nhave: %d %q %q %q\nwant: %d %q %q %q",
+					r.ExitCode, r.Signal, r.Stdout, r.Stderr,
+					tt.wantExit, tt.wantSignal, tt.wantStdout, tt.wantStderr)
+			}
+			if r.PID == 0 || r.Duration == 0 {
+				t.Errorf("PID=%d; Duration=%s", r.PID, r.Duration)
+			}
+
+			_, out, isErr, err := p.Run(context.Background(), "")
+			if !errorContains(err, tt.wantErr) || out != tt.wantOutput || isErr != tt.wantIsError {
+				t.Errorf("\nhave: %q %v %v\nwant: %q %v %q", out, isErr, err, tt.wantOutput, tt.wantIsError, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("adapter", func(t *testing.T) {
+		p := AsParserV2(FuncParser{Decode: func(context.Context, []byte) (any, error) {
+			return map[string]any{}, nil
+		}})
+		r, err := p.Exec(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.ExitCode != 0 || r.Stdout != "{}\n" || r.Stderr != "" {
+			t.Errorf("%#v", r)
+		}
+	})
+}
+
+func errorContains(have error, want string) bool {
+	if have == nil {
+		return want == ""
+	}
+	return want != "" && strings.Contains(have.Error(), want)
+}
@@ -12,9 +12,10 @@ import (
 	"io/fs"
 	"math"
 	"os/exec"
-	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"testing/fstest"
@@ -29,8 +30,22 @@ const (
 	TypeValid testType = iota
 	TypeEncoder
 	TypeInvalid
+	TypeEncoderInvalid
 )
 
+func (t testType) String() string {
+	switch t {
+	case TypeEncoder:
+		return "encoder"
+	case TypeInvalid:
+		return "invalid"
+	case TypeEncoderInvalid:
+		return "encoder-invalid"
+	default:
+		return "valid"
+	}
+}
+
 const DefaultVersion = "1.0.0"
 
 //go:embed tests/*
@@ -96,18 +111,70 @@ type Runner struct {
 	Parallel      int               // Number of tests to run in parallel
 	Timeout       time.Duration     // Maximum time for parse.
 	IntAsFloat    bool              // Int values have type=float.
-	Errors        map[string]string // Expected errors list.
+	Errors        map[string]string // Expected errors; see ErrorMatches.
 	SkipMustError bool              // Tests in SkipTests must fail. Useful for CI.
+	Variants      []string          // Also run tests with modified input; see AllVariants.
+
+	// Roundtrip runs valid tests as a round-trip: the input is decoded with
+	// Decoder, the decoder's output is encoded with Encoder, and the encoder's
+	// output is decoded again with Decoder. The final result is compared to
+	// the JSON description. Requires an Encoder.
+	Roundtrip bool
+
+	// Validity sets how to decide if the parser rejected the input:
+	//
+	//	stderr      Rejected if anything is written to stderr and it exits
+	//	            with one of RejectExitCodes (the default).
+	//	exit-code   Rejected only if it exits with one of RejectExitCodes;
+	//	            stdout is always used on success, and stderr is set as
+	//	            Test.Diagnostics.
+	//
+	// An exit code other than 0 or RejectExitCodes is always a crash.
+	Validity string
+
+	// RejectExitCodes are the exit codes for rejected input; the default is 1.
+	RejectExitCodes []int
+
+	// ErrorMatches are the expected errors for invalid tests, and expected
+	// warnings for valid tests; see ParseErrors for the keys. A test fails if
+	// none of the ErrorMatch for the TOML version match. Errors is added to
+	// this as ErrorMatch.Contains.
+	//
+	// It's an error if a key doesn't match any test that was run.
+	ErrorMatches map[string][]ErrorMatch
+	errors       map[string][]ErrorMatch
+
+	// NormalizeErrors normalizes the output before it's compared to
+	// ErrorMatches; see AllNormalize for the options.
+	NormalizeErrors []string
+
+	// ErrorPositionRegex are regular expressions to find the error position in
+	// the output for invalid tests that have an expected position (see
+	// Test.ReadPosition). The line must be in a group named "line", and the
+	// column in an optional group named "col"; the first expression that
+	// matches is used. The default is DefaultErrorPositionRegex.
+	//
+	// A wrong or missing position fails the test with OutcomeWrongPosition,
+	// or adds a warning if ErrorPositionWarn is set.
+	ErrorPositionRegex []string
+	ErrorPositionWarn  bool
+	positionRegex      []*regexp.Regexp
+
+	// Env has extra environment variables for the commands, as "KEY=VAL".
+	//
+	// TOML_TEST_VERSION, TOML_TEST_NAME, and TOML_TEST_TYPE are always set to
+	// the TOML version, test path, and test type ("valid", "invalid",
+	// "encoder", or "encoder-invalid"). Persistent commands are started only
+	// once, so they don't get TOML_TEST_NAME and TOML_TEST_TYPE.
+	Env []string
+
+	// OnResult is called for every test as soon as it's finished, including
+	// skipped tests. It's never called concurrently.
+	OnResult func(Test)
 }
 
 func NewRunner(r Runner) Runner {
-	if r.Version == "" || r.Version == "1.0" {
-		r.Version = "1.0.0"
-	} else if r.Version == "1.1" {
-		r.Version = "1.1.0"
-	} else if r.Version == "latest" {
-		r.Version = "1.1.0"
-	}
+	r.Version = normalizeVersion(r.Version)
 	if r.Files == nil {
 		r.Files = TestCases()
 	}
@@ -144,14 +211,33 @@ type Tests struct {
 	FailedInvalid int `json:"failed_invalid"`
 	PassedEncoder int `json:"passed_encoder"`
 	FailedEncoder int `json:"failed_encoder"`
+
+	// JSON descriptions the encoder should reject.
+	PassedEncoderInvalid int `json:"passed_encoder_invalid"`
+	FailedEncoderInvalid int `json:"failed_encoder_invalid"`
+
+	// Number of tests where the parser crashed or timed out; these are also
+	// counted in the Failed* fields.
+	Crashed  int `json:"crashed"`
+	TimedOut int `json:"timed_out"`
+
+	// Number of invalid tests with a wrong or missing error position; these
+	// are also counted in FailedInvalid, unless Runner.ErrorPositionWarn is
+	// set.
+	WrongPosition int `json:"wrong_position"`
+
+	// Not all tests were run because the context was cancelled. Not set if all
+	// tests finished before the cancellation.
+	Partial bool `json:"partial"`
 }
 
-// Result is the result of a single test.
+// Test is a single test, and the result of running it.
 type Test struct {
 	Path string `json:"path"` // Path of test, e.g. "valid/string-test"
 
 	// Set when a test is run.
 
+	Outcome          Outcome       `json:"outcome"`            // Outcome of the test.
 	Skipped          bool          `json:"skipped"`            // Skipped this test?
 	Failure          string        `json:"failure"`            // Failure message.
 	Key              string        `json:"key"`                // TOML key the failure occured on; may be blank.
@@ -159,9 +245,20 @@ type Test struct {
 	Output           string        `json:"output"`             // Output from the external program.
 	Want             string        `json:"want"`               // The output we want.
 	OutputFromStderr bool          `json:"output_from_stderr"` // The Output came from stderr, not stdout.
-	PID              int           `json:"pid"`                // PID from test run.
 	Timeout          time.Duration `json:"-"`                  // Maximum time for parse.
 	IntAsFloat       bool          `json:"-"`                  // Int values have type=float.
+	Validity         string        `json:"-"`                  // How to decide if the input was rejected; see Runner.Validity.
+	RejectExitCodes  []int         `json:"-"`                  // Exit codes for rejected input; default is 1.
+	Diagnostics      string        `json:"diagnostics"`        // stderr from the parser if Validity is "exit-code".
+	Stage            string        `json:"stage"`              // Round-trip stage that failed: "decode", "encode", or "decode-encoded".
+	Warnings         []string      `json:"warnings"`           // Valid but ambiguous encoder output; doesn't fail the test.
+	Version          string        `json:"-"`                  // TOML version.
+	Env              []string      `json:"-"`                  // Extra environment variables; see Runner.Env.
+	Elapsed          time.Duration `json:"elapsed"`            // Time it took to run the test, including comparing the output.
+
+	Result // Result from the parser.
+
+	cancelled bool // Parser was stopped because the context was cancelled.
 }
 
 type timeoutError struct{ d time.Duration }
@@ -173,13 +270,8 @@ func (err timeoutError) Error() string {
 // List all tests in Files for the current TOML version.
 func (r Runner) List() ([]string, error) {
 	if _, ok := versions[r.Version]; !ok {
-		v := make([]string, 0, len(versions))
-		for k := range versions {
-			v = append(v, k)
-		}
-		sort.Strings(v)
 		return nil, fmt.Errorf("tomltest.Runner.Run: unknown version: %q (supported: \"%s\")",
-			r.Version, strings.Join(v, `", "`))
+			r.Version, strings.Join(Versions(), `", "`))
 	}
 
 	var (
@@ -209,93 +301,107 @@ func (r Runner) List() ([]string, error) {
 	if err := r.findTOML("invalid", &ls, exclude); err != nil {
 		return nil, fmt.Errorf(`reading "invalid/": %w`, err)
 	}
+	if err := r.findJSON("encoder-invalid", &ls, exclude); err != nil {
+		return nil, fmt.Errorf(`reading "encoder-invalid/": %w`, err)
+	}
 	return ls, nil
 }
 
 // Run all tests listed in t.RunTests.
-//
-// TODO: give option to:
-// - Run all tests with \n replaced with \r\n
-// - Run all tests with EOL removed
-// - Run all tests with '# comment' appended to every line.
 func (r Runner) Run() (Tests, error) {
-	skipped, err := r.findTests()
+	return r.RunContext(context.Background())
+}
+
+// RunContext runs all tests listed in t.RunTests, stopping once the context is
+// cancelled.
+//
+// On cancellation no new tests are started and all running tests are stopped.
+// The tests that finished are returned, with Tests.Partial set if any test
+// wasn't started or was stopped; this is not an error.
+func (r Runner) RunContext(ctx context.Context) (Tests, error) {
+	skipped, err := r.prepare()
 	if err != nil {
 		return Tests{}, fmt.Errorf("tomltest.Runner.Run: %w", err)
 	}
-	if r.Parallel == 0 {
-		r.Parallel = 1
-	}
-	if r.Timeout == 0 {
-		r.Timeout = 1 * time.Second
-	}
-	if r.Errors == nil {
-		r.Errors = make(map[string]string)
-	}
-	nerr := make(map[string]string)
-	for k, v := range r.Errors {
-		if !strings.HasPrefix(k, "invalid/") {
-			k = path.Join("invalid", k)
-		}
-		nerr[strings.TrimSuffix(k, ".toml")] = v
-	}
-	r.Errors = nerr
 
 	var (
 		tests = Tests{
 			Tests:   make([]Test, 0, len(r.RunTests)),
 			Skipped: skipped,
 		}
-		limit = make(chan struct{}, r.Parallel)
-		wg    sync.WaitGroup
-		mu    sync.Mutex
+		limit   = make(chan struct{}, r.Parallel)
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		unused  = make(map[string]struct{}, len(r.errors))
+		partial bool // Tests not started because the context was cancelled.
 	)
-	for _, p := range r.RunTests {
-		t := Test{
-			Path:       p,
-			Timeout:    r.Timeout,
-			IntAsFloat: r.IntAsFloat,
+	for k, m := range r.errors {
+		if m != nil {
+			unused[k] = struct{}{}
 		}
-		if r.Encoder == nil && t.Encoder() {
+	}
+	for _, p := range r.RunTests {
+		t := r.newTest(p)
+		if r.Encoder == nil && (t.Encoder() || t.EncoderInvalid()) {
 			continue
 		}
+		if ctx.Err() != nil {
+			partial = true
+			break
+		}
 		if r.hasSkip(p) && !r.SkipMustError {
-			tests.Skipped++
 			mu.Lock()
-			t.Skipped = true
+			tests.Skipped++
+			t.Skipped, t.Outcome = true, OutcomeSkipped
 			tests.Tests = append(tests.Tests, t)
+			if r.OnResult != nil {
+				r.OnResult(t)
+			}
 			mu.Unlock()
 			continue
 		}
 
-		limit <- struct{}{}
+		select {
+		case limit <- struct{}{}:
+		case <-ctx.Done():
+			partial = true
+			continue
+		}
 		wg.Add(1)
 		go func(p string) {
 			defer func() { <-limit; wg.Done() }()
 
-			cmd := r.Decoder
-			if t.Encoder() {
-				cmd = r.Encoder
-			}
-			t = t.Run(cmd, r.Files)
+			t = r.runTest(ctx, t)
 
 			mu.Lock()
-			if e, ok := r.Errors[p]; t.Invalid() && ok && !t.Failed() && !strings.Contains(t.Output, e) {
-				t.Failure = fmt.Sprintf("%q does not contain %q", t.Output, e)
+			if t.cancelled { // Stopped before it finished.
+				tests.Partial = true
+				mu.Unlock()
+				return
+			}
+			var key string
+			t, key = r.checkError(t)
+			delete(unused, key)
+			var wrongPos bool
+			if t, wrongPos = r.checkPosition(t); wrongPos {
+				tests.WrongPosition++
 			}
-			delete(r.Errors, p)
 
-			if r.SkipMustError && r.hasSkip(p) {
+			if t.Skipped {
+				tests.Skipped++
+			} else if r.SkipMustError && r.hasSkip(p) {
 				if t.Failed() {
 					tests.Skipped++
-					t.Skipped = true
+					t.Skipped, t.Outcome = true, OutcomeSkipped
 					t.Failure = ""
 				} else {
-					t.Failure = "Test skipped with -skip but didn't fail"
+					t.Failure, t.Outcome = "Test skipped with -skip but didn't fail", OutcomeFailed
 					if t.Invalid() {
 						tests.FailedInvalid++
 					} else if t.Encoder() {
 						tests.FailedEncoder++
+					} else if t.EncoderInvalid() {
+						tests.FailedEncoderInvalid++
 					} else {
 						tests.FailedValid++
 					}
@@ -305,6 +411,8 @@ func (r Runner) Run() (Tests, error) {
 					tests.FailedInvalid++
 				} else if t.Encoder() {
 					tests.FailedEncoder++
+				} else if t.EncoderInvalid() {
+					tests.FailedEncoderInvalid++
 				} else {
 					tests.FailedValid++
 				}
@@ -313,33 +421,219 @@ func (r Runner) Run() (Tests, error) {
 					tests.PassedInvalid++
 				} else if t.Encoder() {
 					tests.PassedEncoder++
+				} else if t.EncoderInvalid() {
+					tests.PassedEncoderInvalid++
 				} else {
 					tests.PassedValid++
 				}
 			}
+			switch t.Outcome {
+			case OutcomeCrashed:
+				tests.Crashed++
+			case OutcomeTimedOut:
+				tests.TimedOut++
+			}
 			tests.Tests = append(tests.Tests, t)
+			if r.OnResult != nil {
+				r.OnResult(t)
+			}
 			mu.Unlock()
 		}(p)
 	}
 	wg.Wait()
+	tests.Partial = tests.Partial || partial
 
-	// Sort valid first, encoder second, and invalid last.
-	tr := strings.NewReplacer("encoder/", "wencoder/", "invalid/", "zinvalid/")
+	// Sort valid first, then encoder, encoder-invalid, and invalid last.
+	tr := strings.NewReplacer("encoder-invalid/", "xencoder-invalid/", "encoder/", "wencoder/", "invalid/", "zinvalid/")
 	sort.Slice(tests.Tests, func(i, j int) bool {
 		return tr.Replace(tests.Tests[i].Path) < tr.Replace(tests.Tests[j].Path)
 	})
 
-	if len(r.Errors) > 0 {
-		keys := make([]string, 0, len(r.Errors))
-		for k := range r.Errors {
+	if len(unused) > 0 && !tests.Partial {
+		keys := make([]string, 0, len(unused))
+		for k := range unused {
 			keys = append(keys, k)
 		}
+		sort.Strings(keys)
 		return tests, fmt.Errorf("errors didn't match anything: %q", keys)
 	}
 	return tests, nil
 }
 
-// find all TOML files in 'path' relative to the test directory.
+// prepare the runner: expand RunTests, set defaults, and merge Errors and
+// ErrorMatches.
+func (r *Runner) prepare() (int, error) {
+	skipped, err := r.findTests()
+	if err != nil {
+		return 0, err
+	}
+	return skipped, r.setDefaults()
+}
+
+// setDefaults sets the defaults, checks the options, and merges Errors and
+// ErrorMatches. This is everything prepare does except expanding RunTests,
+// which is slow and not needed for running generated documents.
+func (r *Runner) setDefaults() error {
+	if r.Parallel == 0 {
+		r.Parallel = 1
+	}
+	if r.Timeout == 0 {
+		r.Timeout = 1 * time.Second
+	}
+	switch r.Validity {
+	case "":
+		r.Validity = "stderr"
+	case "stderr", "exit-code":
+	default:
+		return fmt.Errorf("unknown Validity: %q", r.Validity)
+	}
+	if r.Roundtrip && r.Encoder == nil {
+		return errors.New("Roundtrip requires an Encoder")
+	}
+	if len(r.RejectExitCodes) == 0 {
+		r.RejectExitCodes = []int{1}
+	}
+	for _, c := range r.RejectExitCodes {
+		if c <= 0 || c > 255 {
+			return fmt.Errorf("invalid exit code in RejectExitCodes: %d", c)
+		}
+	}
+	for _, e := range r.Env {
+		if k, _, ok := strings.Cut(e, "="); !ok || k == "" {
+			return fmt.Errorf("invalid Env: %q (must be KEY=VAL)", e)
+		}
+	}
+	var err error
+	r.positionRegex, err = compilePositionRegex(r.ErrorPositionRegex)
+	if err != nil {
+		return err
+	}
+	if _, err := NormalizeOutput("", 0, r.NormalizeErrors); err != nil {
+		return fmt.Errorf("invalid NormalizeErrors: %w", err)
+	}
+	r.errors = make(map[string][]ErrorMatch, len(r.Errors)+len(r.ErrorMatches))
+	for k, v := range r.Errors {
+		r.errors[errorKey(k)] = []ErrorMatch{{Contains: []string{v}}}
+	}
+	for k, v := range r.ErrorMatches {
+		var (
+			key = errorKey(k)
+			set bool
+		)
+		for _, m := range v {
+			if err := checkVersions(m.Versions); err != nil {
+				return fmt.Errorf("invalid ErrorMatches %q: %w", k, err)
+			}
+			if m.forVersion(r.Version) {
+				r.errors[key], set = append(r.errors[key], m), true
+			}
+		}
+		// Only for a different version; keep the key so a glob isn't used
+		// instead, but don't check anything. It's not reported as unmatched
+		// either, as the test may not exist in this version.
+		if !set && len(v) > 0 {
+			if _, ok := r.errors[key]; !ok {
+				r.errors[key] = nil
+			}
+		}
+	}
+	return nil
+}
+
+func (r Runner) newTest(path string) Test {
+	return Test{
+		Path:            path,
+		Timeout:         r.Timeout,
+		IntAsFloat:      r.IntAsFloat,
+		Validity:        r.Validity,
+		RejectExitCodes: r.RejectExitCodes,
+		Version:         r.Version,
+		Env:             r.Env,
+	}
+}
+
+// runTest runs a single test with the decoder or encoder.
+func (r Runner) runTest(ctx context.Context, t Test) Test {
+	if r.Roundtrip && t.Type() == TypeValid {
+		return t.RunRoundtrip(ctx, r.Decoder, r.Encoder, r.Files)
+	}
+	cmd := r.Decoder
+	if t.Encoder() || t.EncoderInvalid() {
+		cmd = r.Encoder
+	}
+	return t.RunContext(ctx, cmd, r.Files)
+}
+
+// checkError checks that the output matches the expected error from
+// ErrorMatches, or the warnings for valid tests. It returns the key that was
+// used, if any.
+func (r Runner) checkError(t Test) (Test, string) {
+	if t.Type() != TypeInvalid && t.Type() != TypeValid {
+		return t, ""
+	}
+	key, matches, ok := r.findErrors(t.basePath())
+	if !ok || t.Failed() || t.Skipped || len(matches) == 0 {
+		return t, key
+	}
+
+	out := t.Output
+	if t.Type() == TypeValid {
+		out = strings.Join(append([]string{t.Diagnostics}, t.Warnings...), "\n")
+	}
+	out, _ = NormalizeOutput(out, t.PID, r.NormalizeErrors) // Checked in prepare.
+	for _, m := range matches {
+		if m.match(out, r.positionRegex) {
+			return t, key
+		}
+	}
+
+	want := make([]string, 0, len(matches))
+	for _, m := range matches {
+		want = append(want, m.String())
+	}
+	if t.Type() == TypeValid {
+		t.Failure = fmt.Sprintf("Expected a warning which %s, but have:\n%q", strings.Join(want, ";\nor "), out)
+	} else {
+		t.Failure = fmt.Sprintf("Expected an error which %s, but have:\n%q", strings.Join(want, ";\nor "), out)
+	}
+	t.Outcome = OutcomeFailed
+	return t, key
+}
+
+// checkPosition checks that the output has the expected error position, if the
+// test has one. wrong is set if the position is wrong or missing.
+func (r Runner) checkPosition(t Test) (_ Test, wrong bool) {
+	if !t.Invalid() || t.Failed() || t.Skipped {
+		return t, false
+	}
+	want, ok, err := t.ReadPosition(r.Files)
+	if err != nil {
+		t = t.bug(err.Error())
+		t.Outcome = OutcomeFailed
+		return t, false
+	}
+	if !ok {
+		return t, false
+	}
+
+	var msg string
+	if have, ok := findPosition(t.Output, r.positionRegex); !ok {
+		msg = fmt.Sprintf("Expected an error at %s, but no position was found in the output.", want)
+	} else if !want.matches(have) {
+		msg = fmt.Sprintf("Expected an error at %s, but the error was reported at %s.", want, have)
+	} else {
+		return t, false
+	}
+	if r.ErrorPositionWarn {
+		t.Warnings = append(t.Warnings, msg)
+	} else {
+		t.Failure, t.Outcome = msg, OutcomeWrongPosition
+	}
+	return t, true
+}
+
+// find all TOML files in 'path' relative to the test directory. Tests in .multi
+// files are expanded to one test per line.
 func (r Runner) findTOML(path string, appendTo *[]string, exclude []string) error {
 	// It's okay if the directory doesn't exist. Mainly to make testing a bit
 	// easier.
@@ -351,22 +645,61 @@ func (r Runner) findTOML(path string, appendTo *[]string, exclude []string) erro
 		if err != nil {
 			return err
 		}
-		if d.IsDir() || !strings.HasSuffix(path, ".toml") {
+		if d.IsDir() {
 			return nil
 		}
-
-		path = strings.TrimSuffix(path, ".toml")
-		for _, e := range exclude {
-			if ok, _ := filepath.Match(e, path); ok {
-				return nil
+		if strings.HasSuffix(path, ".multi") {
+			tests, err := readMulti(r.Files, path)
+			if err != nil {
+				return err
+			}
+			for _, t := range tests {
+				if p := path + "#" + t.name; !isExcluded(p, exclude) {
+					*appendTo = append(*appendTo, p)
+				}
 			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".toml") {
+			return nil
 		}
 
-		*appendTo = append(*appendTo, path)
+		if path = strings.TrimSuffix(path, ".toml"); !isExcluded(path, exclude) {
+			*appendTo = append(*appendTo, path)
+		}
 		return nil
 	})
 }
 
+// find all JSON files in 'path' relative to the test directory.
+func (r Runner) findJSON(path string, appendTo *[]string, exclude []string) error {
+	if _, err := fs.Stat(r.Files, path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return fs.WalkDir(r.Files, path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		if path = strings.TrimSuffix(path, ".json"); !isExcluded(path, exclude) {
+			*appendTo = append(*appendTo, path)
+		}
+		return nil
+	})
+}
+
+func isExcluded(path string, exclude []string) bool {
+	for _, e := range exclude {
+		if ok, _ := filepath.Match(e, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // Expand RunTest glob patterns, or return all tests if RunTests if empty.
 func (r *Runner) findTests() (int, error) {
 	ls, err := r.List()
@@ -390,119 +723,254 @@ func (r *Runner) findTests() (int, error) {
 		r.RunTests, skip = run, len(ls)-len(run)
 	}
 
-	// Expand invalid tests ending in ".multi.toml"
-	expanded := make([]string, 0, len(r.RunTests))
-	for _, path := range r.RunTests {
-		if !strings.HasSuffix(path, ".multi") {
-			expanded = append(expanded, path)
-			continue
+	if len(r.Variants) > 0 {
+		for _, v := range r.Variants {
+			if !slicesContains(AllVariants, v) {
+				return 0, fmt.Errorf("unknown variant %q (supported: \"%s\")",
+					v, strings.Join(AllVariants, `", "`))
+			}
 		}
-
-		d, err := fs.ReadFile(r.Files, path+".toml")
-		if err != nil {
-			return 0, err
+		withVariants := make([]string, 0, len(r.RunTests)*(len(r.Variants)+1))
+		for _, path := range r.RunTests {
+			withVariants = append(withVariants, path)
+			if strings.HasPrefix(path, "encoder") {
+				continue
+			}
+			for _, v := range r.Variants {
+				withVariants = append(withVariants, path+"@"+v)
+			}
 		}
-
-		fmt.Println(string(d))
+		r.RunTests = withVariants
 	}
-	r.RunTests = expanded
 
 	return skip, nil
 }
 
+// hasSkip reports if path matches SkipTests. Skipping a test also skips all
+// variants of it.
 func (r Runner) hasSkip(path string) bool {
+	base, _, _ := strings.Cut(path, "@")
 	for _, s := range r.SkipTests {
 		if m, _ := filepath.Match(s, path); m {
 			return true
 		}
+		if m, _ := filepath.Match(s, base); m {
+			return true
+		}
+	}
+	return false
+}
+
+func joinInts(s []int, sep string) string {
+	ss := make([]string, 0, len(s))
+	for _, n := range s {
+		ss = append(ss, strconv.Itoa(n))
+	}
+	return strings.Join(ss, sep)
+}
+
+func slicesContains(s []string, find string) bool {
+	for _, ss := range s {
+		if ss == find {
+			return true
+		}
 	}
 	return false
 }
 
 // CommandParser calls an external command.
+//
+// The input is sent on stdin. The placeholders {file}, {version}, and {name} in
+// the command are replaced with the path to a temporary file with the input,
+// the TOML version, and the test name. Stdin is empty if {file} is used.
 type CommandParser struct {
-	cmd []string
+	cmd   []string
+	shell bool
 }
 
 func (c CommandParser) Cmd() []string { return c.cmd }
 
 func (c CommandParser) Run(ctx context.Context, input string) (pid int, output string, outputIsError bool, err error) {
-	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
-	cmd := exec.CommandContext(ctx, c.cmd[0])
-	cmd.Args = c.cmd
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = strings.NewReader(input), stdout, stderr
+	r, err := c.Exec(ctx, input)
+	if err != nil {
+		return r.PID, "", false, err
+	}
+	output, outputIsError, err = r.output(validity{})
+	return r.PID, output, outputIsError, err
+}
 
-	err = cmd.Run()
+func (c CommandParser) Exec(ctx context.Context, input string) (Result, error) {
+	inv, hasInv := InvocationFromContext(ctx)
+	args, input, cleanup, err := expandCommand(c.cmd, inv, input, c.shell)
 	if err != nil {
-		eErr := &exec.ExitError{}
-		if errors.As(err, &eErr) && eErr.ExitCode() == 1 {
-			fmt.Fprintf(stderr, "\nExit %d\n", eErr.ProcessState.ExitCode())
-			err = nil
-		}
+		return Result{}, err
+	}
+	defer cleanup()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, args[0])
+	cmd.Args = args
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = strings.NewReader(input), stdout, stderr
+	if hasInv {
+		cmd.Env = inv.Environ()
 	}
 
+	start := time.Now()
+	err = cmd.Run()
+	r := Result{Duration: time.Since(start)}
 	if cmd.Process != nil {
-		pid = cmd.Process.Pid
+		r.PID = cmd.Process.Pid
 	}
-	if stderr.Len() > 0 {
-		return pid, strings.TrimSpace(stderr.String()) + "\n", true, err
+	if cmd.ProcessState == nil {
+		return r, err
 	}
-	return pid, strings.TrimSpace(stdout.String()) + "\n", false, err
+	r.setProcessState(cmd.ProcessState)
+	r.Stdout, r.Stderr = stdout.String(), stderr.String()
+	return r, nil
 }
 
 func NewCommandParser(cmd []string) CommandParser {
-	return CommandParser{cmd}
+	return CommandParser{cmd: cmd}
+}
+
+// NewShellCommandParser creates a CommandParser that runs cmd with "sh -c".
+// Placeholders are quoted.
+func NewShellCommandParser(cmd string) CommandParser {
+	return CommandParser{cmd: []string{"sh", "-c", cmd}, shell: true}
 }
 
 // Run this test.
+//
+// The test is marked as skipped if it's a variant that doesn't apply to this
+// test.
 func (t Test) Run(p Parser, fsys fs.FS) Test {
-	if t.Invalid() {
-		return t.runInvalid(p, fsys)
+	return t.RunContext(context.Background(), p, fsys)
+}
+
+// RunContext runs this test, stopping the parser if the context is cancelled.
+func (t Test) RunContext(ctx context.Context, p Parser, fsys fs.FS) Test {
+	if t.skipVariant(fsys) {
+		t.Skipped, t.Outcome = true, OutcomeSkipped
+		return t
+	}
+	start := time.Now()
+	if t.Invalid() || t.EncoderInvalid() {
+		t = t.runInvalid(ctx, p, fsys)
+	} else {
+		t = t.runValid(ctx, p, fsys)
 	}
-	return t.runValid(p, fsys)
+	t.Elapsed = time.Since(start)
+	return t.setOutcome()
 }
 
-func (t Test) runInvalid(p Parser, fsys fs.FS) Test {
-	var err error
-	_, t.Input, err = t.ReadInput(fsys)
-	if err != nil {
-		return t.bug(err.Error())
+// RunRoundtrip runs this valid test as a round-trip: the input is decoded with
+// dec, the decoder's output is encoded with enc, and the encoder's output is
+// decoded again with dec. The final result is compared to the JSON
+// description.
+//
+// On failure Stage is set to the stage that failed, and Input and Output are
+// set to the input and output of that stage. Tests that aren't valid tests are
+// run as usual.
+func (t Test) RunRoundtrip(ctx context.Context, dec, enc Parser, fsys fs.FS) Test {
+	if t.Type() != TypeValid {
+		p := dec
+		if t.Encoder() || t.EncoderInvalid() {
+			p = enc
+		}
+		return t.RunContext(ctx, p, fsys)
+	}
+	if t.skipVariant(fsys) {
+		t.Skipped, t.Outcome = true, OutcomeSkipped
+		return t
 	}
+	start := time.Now()
+	t = t.runRoundtrip(ctx, dec, enc, fsys)
+	t.Elapsed = time.Since(start)
+	return t.setOutcome()
+}
+
+func (t Test) skipVariant(fsys fs.FS) bool {
+	if t.Variant() == "" {
+		return false
+	}
+	_, _, err := t.ReadInput(fsys)
+	return errors.As(err, &variantSkipError{})
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+func (t Test) setOutcome() Test {
+	if t.Outcome == OutcomeNone {
+		t.Outcome = OutcomePassed
+		if t.Failed() {
+			t.Outcome = OutcomeFailed
+		}
+	}
+	return t
+}
+
+// runParser runs the parser with the timeout.
+func (t Test) runParser(ctx context.Context, p Parser) (Test, error) {
+	tctx, cancel := context.WithTimeout(ctx, t.Timeout)
 	defer cancel()
+	inv := Invocation{Version: t.Version, Env: t.Env}
+	if t.Path != "" {
+		inv.Name, inv.Type = t.Path, t.Type().String()
+	}
+	tctx = WithInvocation(tctx, inv)
 
-	t.PID, t.Output, t.OutputFromStderr, err = p.Run(ctx, t.Input)
+	var err error
+	v := t.validity()
+	t.Result, t.Output, t.OutputFromStderr, err = execParser(tctx, p, t.Input, v)
+	if v.exitCode {
+		t.Diagnostics = t.Stderr
+	}
 	if ctx.Err() != nil {
+		err = ctx.Err()
+	} else if tctx.Err() != nil {
 		err = timeoutError{t.Timeout}
 	}
+	return t, err
+}
+
+func (t Test) runInvalid(ctx context.Context, p Parser, fsys fs.FS) Test {
+	var err error
+	_, t.Input, err = t.ReadInput(fsys)
+	if err != nil {
+		return t.bug(err.Error())
+	}
+
+	t, err = t.runParser(ctx, p)
 	if err != nil {
-		return t.fail(err.Error())
+		return t.failErr(err)
 	}
 	if !t.OutputFromStderr {
 		return t.fail("Expected an error, but no error was reported.")
 	}
+	if v := t.validity(); !v.rejected(t.ExitCode) {
+		return t.failf("Expected exit code %s, but the parser exited with %d.", joinInts(v.rejectCodes(), " or "), t.ExitCode)
+	}
 	return t
 }
 
-func (t Test) runValid(p Parser, fsys fs.FS) Test {
+func (t Test) runValid(ctx context.Context, p Parser, fsys fs.FS) Test {
 	var err error
 	_, t.Input, err = t.ReadInput(fsys)
 	if err != nil {
 		return t.bug(err.Error())
 	}
+	return t.runValidInput(ctx, p, fsys)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
-	defer cancel()
-
-	t.PID, t.Output, t.OutputFromStderr, err = p.Run(ctx, t.Input)
-	if ctx.Err() != nil {
-		err = timeoutError{t.Timeout}
-	}
+// runValidInput runs the parser with Input, and compares the output to the
+// wanted output from fsys.
+func (t Test) runValidInput(ctx context.Context, p Parser, fsys fs.FS) Test {
+	t, err := t.runParser(ctx, p)
 	if err != nil {
-		return t.fail(err.Error())
+		return t.failErr(err)
 	}
 	if t.OutputFromStderr {
+		if t.validity().rejected(t.ExitCode) {
+			t.Outcome = OutcomeRejected
+		}
 		return t.fail(t.Output)
 	}
 	if t.Output == "" {
@@ -519,6 +987,9 @@ func (t Test) runValid(p Parser, fsys fs.FS) Test {
 		if _, err := toml.Decode(t.Output, &have); err != nil {
 			return t.failf("decode TOML from encoder:\n  %s", err)
 		}
+		if t = t.checkEncoded(); t.Failed() {
+			return t
+		}
 		return t.CompareTOML(want, have)
 	}
 
@@ -536,22 +1007,88 @@ func (t Test) runValid(p Parser, fsys fs.FS) Test {
 	return t.CompareJSON(want, have)
 }
 
+func (t Test) runRoundtrip(ctx context.Context, dec, enc Parser, fsys fs.FS) Test {
+	t.Stage = "decode"
+	t = t.runValid(ctx, dec, fsys)
+	if t.Failed() {
+		return t.stageFailed("decoding the input")
+	}
+
+	input := t.Input
+	t.Stage, t.Input = "encode", t.Output
+	t, err := t.runParser(ctx, enc)
+	if err != nil {
+		return t.failErr(err).stageFailed("encoding the decoder output")
+	}
+	if t.OutputFromStderr {
+		if t.validity().rejected(t.ExitCode) {
+			t.Outcome = OutcomeRejected
+		}
+		return t.fail(t.Output).stageFailed("encoding the decoder output")
+	}
+	if t.Output == "" {
+		return t.fail("stdout is empty").stageFailed("encoding the decoder output")
+	}
+	if t = t.checkEncoded(); t.Failed() {
+		return t.stageFailed("encoding the decoder output")
+	}
+
+	t.Stage, t.Input = "decode-encoded", t.Output
+	t = t.runValidInput(ctx, dec, fsys)
+	if t.Failed() {
+		return t.stageFailed("decoding the encoder output")
+	}
+	t.Stage, t.Input = "", input
+	return t
+}
+
+// checkEncoded checks that the encoder output only uses syntax from the TOML
+// version, and sets Warnings for ambiguous output.
+func (t Test) checkEncoded() Test {
+	errs, warns := checkEncoded(t.Output, t.Version)
+	t.Warnings = append(t.Warnings, warns...)
+	if len(errs) > 0 {
+		return t.failf("encoder output is not valid TOML %s:\n  %s", t.Version, strings.Join(errs, "\n  "))
+	}
+	return t
+}
+
+func (t Test) stageFailed(desc string) Test {
+	t.Failure = fmt.Sprintf("Round-trip failed while %s (stage %q):\n%s", desc, t.Stage, t.Failure)
+	return t
+}
+
 // ReadInput reads the file sent to the encoder.
+//
+// For variants the modified input is returned.
 func (t Test) ReadInput(fsys fs.FS) (path, data string, err error) {
-	path = t.Path + map[bool]string{true: ".json", false: ".toml"}[t.Encoder()]
-	d, err := fs.ReadFile(fsys, path)
+	path, data, err = t.readFile(fsys, t.Encoder() || t.EncoderInvalid())
 	if err != nil {
 		return path, "", err
 	}
-	return path, string(d), nil
+	if v := t.Variant(); v != "" {
+		data, err := applyVariant(v, data, t.Invalid())
+		return path, data, err
+	}
+	return path, data, nil
 }
 
 func (t Test) ReadWant(fsys fs.FS) (path, data string, err error) {
-	if t.Invalid() {
+	if t.Invalid() || t.EncoderInvalid() {
 		panic("testoml.Test.ReadWant: invalid tests do not have a 'correct' version")
 	}
 
-	path = t.Path + map[bool]string{true: ".toml", false: ".json"}[t.Encoder()]
+	return t.readFile(fsys, !t.Encoder())
+}
+
+// readFile reads the TOML or JSON file for this test.
+func (t Test) readFile(fsys fs.FS, asJSON bool) (path, data string, err error) {
+	if file, name, ok := strings.Cut(t.basePath(), "#"); ok {
+		data, err := readMultiTest(fsys, file, name, asJSON)
+		return file, data, err
+	}
+
+	path = t.basePath() + map[bool]string{true: ".json", false: ".toml"}[asJSON]
 	d, err := fs.ReadFile(fsys, path)
 	if err != nil {
 		return path, "", err
@@ -633,25 +1170,59 @@ func floatToInt(m map[string]any) map[string]any {
 	return newm
 }
 
-// Test type: "valid", "encoder", "invalid"
+// Test type: "valid", "encoder", "invalid", "encoder-invalid"
 func (t Test) Type() testType {
 	if strings.HasPrefix(t.Path, "invalid") {
 		return TypeInvalid
 	}
+	if strings.HasPrefix(t.Path, "encoder-invalid") {
+		return TypeEncoderInvalid
+	}
 	if strings.HasPrefix(t.Path, "encoder") {
 		return TypeEncoder
 	}
 	return TypeValid
 }
 
+// Variant gets the name of the input variant, or "" if this isn't a variant.
+func (t Test) Variant() string {
+	_, v, _ := strings.Cut(t.Path, "@")
+	return v
+}
+
+// basePath gets the path without the variant.
+func (t Test) basePath() string {
+	p, _, _ := strings.Cut(t.Path, "@")
+	return p
+}
+
+func (t Test) validity() validity {
+	return validity{exitCode: t.Validity == "exit-code", reject: t.RejectExitCodes}
+}
+
 func (t Test) Encoder() bool { return t.Type() == TypeEncoder }
 func (t Test) Invalid() bool { return t.Type() == TypeInvalid }
 
+// EncoderInvalid reports if this is a test with a JSON description the encoder
+// should reject.
+func (t Test) EncoderInvalid() bool { return t.Type() == TypeEncoderInvalid }
+
 func (t Test) fail(msg string) Test {
 	t.Failure = msg
 	return t
 }
 
+// failErr fails the test with an error from running the parser.
+func (t Test) failErr(err error) Test {
+	t.Outcome = OutcomeCrashed
+	if errors.As(err, &timeoutError{}) {
+		t.Outcome = OutcomeTimedOut
+	} else if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		t.cancelled = true
+	}
+	return t.fail(err.Error())
+}
+
 func (t Test) failf(format string, v ...any) Test {
 	t.Failure = fmt.Sprintf(format, v...)
 	return t
@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"testing/fstest"
+	"time"
+
+	"github.com/BurntSushi/toml"
 )
 
 func notInList(t *testing.T, list []string, str string) {
@@ -38,6 +42,39 @@ func TestVersion(t *testing.T) {
 	notInList(t, ls, "valid/string/escape-esc")
 }
 
+func TestParseVersions(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{"1.0", "1.0.0", ""},
+		{"1.1,1.0", "1.0.0 1.1.0", ""},
+		{"1.0.0, 1.0,1.1", "1.0.0 1.1.0", ""},
+		{"latest", "1.1.0", ""},
+		{"all", "1.0.0 1.1.0", ""},
+		{"1.0,0.9", "", `unknown version: "0.9"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			have, err := ParseVersions(tt.in)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+			if h := strings.Join(have, " "); h != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s", h, tt.want)
+			}
+		})
+	}
+}
+
+// tomlDecode decodes TOML with BurntSushi/toml, for use in FuncParser.Decode.
+func tomlDecode(ctx context.Context, data []byte) (any, error) {
+	var v any
+	_, err := toml.Decode(string(data), &v)
+	return v, err
+}
+
 type testParser struct{}
 
 func (t *testParser) Cmd() []string { return nil }
@@ -144,3 +181,452 @@ func TestSkipMustError(t *testing.T) {
 		t.Errorf("wrong failure message: %q", tests.Tests[0].Failure)
 	}
 }
+
+func TestVariants(t *testing.T) {
+	var inputs []string
+	r := NewRunner(Runner{
+		Decoder: FuncParser{Decode: func(ctx context.Context, data []byte) (any, error) {
+			inputs = append(inputs, string(data))
+			return tomlDecode(ctx, data)
+		}},
+		Variants: []string{"crlf", "no-eol", "comments"},
+		Files: fstest.MapFS{
+			"valid/a.toml":   &fstest.MapFile{Data: []byte("a = 1\n")},
+			"valid/a.json":   &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"valid/b.toml":   &fstest.MapFile{Data: []byte("b = '''\nx\n'''")},
+			"valid/b.json":   &fstest.MapFile{Data: []byte(`{"b": {"type":"string","value":"x\n"}}`)},
+			"invalid/a.toml": &fstest.MapFile{Data: []byte("a = 1\n2")},
+		},
+	})
+	tests, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var have []string
+	for _, test := range tests.Tests {
+		if test.Failed() {
+			t.Errorf("%s: %s", test.Path, test.Failure)
+		}
+		have = append(have, fmt.Sprintf("%s skipped=%t", test.Path, test.Skipped))
+	}
+	want := []string{
+		"valid/a skipped=false",
+		"valid/a@comments skipped=false",
+		"valid/a@crlf skipped=false",
+		"valid/a@no-eol skipped=false",
+		"valid/b skipped=false",
+		"valid/b@comments skipped=false",
+		"valid/b@crlf skipped=true",   // Changes value of multi-line string.
+		"valid/b@no-eol skipped=true", // No final newline.
+		"invalid/a skipped=false",
+		"invalid/a@comments skipped=false",
+		"invalid/a@crlf skipped=false",
+		"invalid/a@no-eol skipped=true",
+	}
+	if strings.Join(have, "\n") != strings.Join(want, "\n") {
+		t.Errorf("\nhave:\n%s\n\nwant:\n%s", strings.Join(have, "\n"), strings.Join(want, "\n"))
+	}
+
+	for _, in := range inputs {
+		if strings.Contains(in, "x # comment") {
+			t.Errorf("comment added inside multi-line string:\n%s", in)
+		}
+	}
+}
+
+func TestMulti(t *testing.T) {
+	r := NewRunner(Runner{
+		Decoder: FuncParser{Decode: tomlDecode},
+		Files: fstest.MapFS{
+			"valid/a.multi": &fstest.MapFile{Data: []byte("# Comment\n\na = 1\nb = 2\n")},
+			"invalid/b.multi": &fstest.MapFile{Data: []byte(
+				"# Comment\n\nkey-one = 1\\x00\nkey-two = '\\\\x00'x\n")},
+		},
+	})
+	ls, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "valid/a.multi#01 valid/a.multi#02 invalid/b.multi#key-one invalid/b.multi#key-two"
+	if have := strings.Join(ls, " "); have != want {
+		t.Fatalf("\nhave: %s\nwant: %s", have, want)
+	}
+
+	tests, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests.Tests {
+		if test.Failed() {
+			t.Errorf("%s: %s", test.Path, test.Failure)
+		}
+		switch test.Path {
+		case "valid/a.multi#02":
+			if test.Input != "b = 2\n" {
+				t.Errorf("wrong input: %q", test.Input)
+			}
+		case "invalid/b.multi#key-one":
+			if test.Input != "key-one = 1\x00\n" {
+				t.Errorf("wrong input: %q", test.Input)
+			}
+		case "invalid/b.multi#key-two":
+			if test.Input != "key-two = '\\\\x00'x\n" {
+				t.Errorf("wrong input: %q", test.Input)
+			}
+		}
+	}
+	if tests.PassedValid != 2 || tests.PassedInvalid != 2 {
+		t.Errorf("PassedValid=%d; PassedInvalid=%d", tests.PassedValid, tests.PassedInvalid)
+	}
+}
+
+func TestOnResult(t *testing.T) {
+	var have []string
+	r := NewRunner(Runner{
+		Decoder:   &testParser{},
+		Parallel:  4,
+		SkipTests: []string{"invalid/b"},
+		OnResult:  func(t Test) { have = append(have, t.Path) },
+		Files: fstest.MapFS{
+			"valid/a.toml":       &fstest.MapFile{Data: []byte(`a=1`)},
+			"valid/a.json":       &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"invalid/a.toml":     &fstest.MapFile{Data: []byte(`a=`)},
+			"invalid/b.toml":     &fstest.MapFile{Data: []byte(`b=`)},
+			"invalid/dir/c.toml": &fstest.MapFile{Data: []byte(`c=`)},
+		},
+	})
+	tests, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have) != len(tests.Tests) || len(have) != 4 {
+		t.Errorf("OnResult called %d times for %d tests: %v", len(have), len(tests.Tests), have)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := NewRunner(Runner{
+		Decoder: FuncParser{Decode: func(pctx context.Context, data []byte) (any, error) {
+			if string(data) == "hang=" {
+				cancel()
+				<-pctx.Done()
+				return nil, pctx.Err()
+			}
+			return tomlDecode(pctx, data)
+		}},
+		Files: fstest.MapFS{
+			"valid/a.toml":   &fstest.MapFile{Data: []byte(`a=1`)},
+			"valid/a.json":   &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"invalid/a.toml": &fstest.MapFile{Data: []byte(`hang=`)},
+			"invalid/b.toml": &fstest.MapFile{Data: []byte(`b=`)},
+		},
+		Errors: map[string]string{"invalid/b": "not run"},
+	})
+	tests, err := r.RunContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tests.Partial {
+		t.Error("Partial not set")
+	}
+	if len(tests.Tests) != 1 || tests.Tests[0].Path != "valid/a" || tests.PassedValid != 1 {
+		t.Errorf("wrong tests: %#v", tests)
+	}
+}
+
+// Tests that failed before the context was cancelled should be kept, and the
+// result isn't partial if all tests finished.
+func TestRunContextFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	aDone, bDone := make(chan struct{}), make(chan struct{})
+	r := NewRunner(Runner{
+		Parallel: 2,
+		Decoder: FuncParser{Decode: func(pctx context.Context, data []byte) (any, error) {
+			if string(data) == "b=1" {
+				defer close(bDone)
+				<-aDone
+			}
+			return tomlDecode(pctx, data)
+		}},
+		OnResult: func(t Test) {
+			if t.Path == "valid/a" { // Cancel while valid/b is waiting to be added.
+				close(aDone)
+				<-bDone
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}
+		},
+		Files: fstest.MapFS{
+			"valid/a.toml": &fstest.MapFile{Data: []byte(`a=1`)},
+			"valid/a.json": &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"valid/b.toml": &fstest.MapFile{Data: []byte(`b=1`)},
+			"valid/b.json": &fstest.MapFile{Data: []byte(`{"b": {"type":"integer","value":"2"}}`)},
+		},
+	})
+	tests, err := r.RunContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests.Partial {
+		t.Error("Partial set")
+	}
+	if len(tests.Tests) != 2 || tests.PassedValid != 1 || tests.FailedValid != 1 {
+		t.Errorf("wrong tests: %#v", tests)
+	}
+}
+
+type resultParser map[string]Result
+
+func (p resultParser) Cmd() []string { return []string{"result-parser"} }
+func (p resultParser) Run(ctx context.Context, input string) (int, string, bool, error) {
+	panic("not called")
+}
+func (p resultParser) Exec(ctx context.Context, input string) (Result, error) {
+	if input == "hang" {
+		<-ctx.Done()
+		return Result{Signal: "killed", ExitCode: -1}, nil
+	}
+	return p[input], nil
+}
+
+func TestOutcome(t *testing.T) {
+	r := NewRunner(Runner{
+		Decoder: resultParser{
+			"pass":     {Stdout: `{}`},
+			"reject":   {Stderr: "oops", ExitCode: 1},
+			"exit2":    {Stderr: "oops", ExitCode: 2},
+			"segv":     {Signal: "segmentation fault", ExitCode: -1},
+			"warn":     {Stderr: "oops"},
+			"accepted": {Stdout: `{}`},
+		},
+		Timeout: 50 * time.Millisecond,
+		Files: fstest.MapFS{
+			"valid/pass.toml":    &fstest.MapFile{Data: []byte(`pass`)},
+			"valid/pass.json":    &fstest.MapFile{Data: []byte(`{}`)},
+			"valid/reject.toml":  &fstest.MapFile{Data: []byte(`reject`)},
+			"valid/reject.json":  &fstest.MapFile{Data: []byte(`{}`)},
+			"valid/hang.toml":    &fstest.MapFile{Data: []byte(`hang`)},
+			"valid/hang.json":    &fstest.MapFile{Data: []byte(`{}`)},
+			"invalid/pass.toml":  &fstest.MapFile{Data: []byte(`reject`)},
+			"invalid/exit2.toml": &fstest.MapFile{Data: []byte(`exit2`)},
+			"invalid/segv.toml":  &fstest.MapFile{Data: []byte(`segv`)},
+			"invalid/warn.toml":  &fstest.MapFile{Data: []byte(`warn`)},
+			"invalid/acc.toml":   &fstest.MapFile{Data: []byte(`accepted`)},
+		},
+	})
+	tests, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Outcome{
+		"valid/pass":    OutcomePassed,
+		"valid/reject":  OutcomeRejected,
+		"valid/hang":    OutcomeTimedOut,
+		"invalid/pass":  OutcomePassed,
+		"invalid/exit2": OutcomeCrashed,
+		"invalid/segv":  OutcomeCrashed,
+		"invalid/warn":  OutcomeFailed,
+		"invalid/acc":   OutcomeFailed,
+	}
+	for _, test := range tests.Tests {
+		if test.Outcome != want[test.Path] {
+			t.Errorf("%s: have %s, want %s (%s)", test.Path, test.Outcome, want[test.Path], test.Failure)
+		}
+	}
+	if tests.PassedValid != 1 || tests.FailedValid != 2 || tests.PassedInvalid != 1 || tests.FailedInvalid != 4 ||
+		tests.Crashed != 2 || tests.TimedOut != 1 {
+		t.Errorf("wrong counts: %#v", tests)
+	}
+}
+
+func TestValidity(t *testing.T) {
+	p := resultParser{
+		"valid":   {Stdout: `{}`, Stderr: "warning"},
+		"invalid": {Stderr: "error", ExitCode: 65},
+	}
+	files := fstest.MapFS{
+		"valid/a.toml":   &fstest.MapFile{Data: []byte(`valid`)},
+		"valid/a.json":   &fstest.MapFile{Data: []byte(`{}`)},
+		"invalid/a.toml": &fstest.MapFile{Data: []byte(`invalid`)},
+	}
+
+	tests, err := NewRunner(Runner{Decoder: p, Files: files}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests.FailedValid != 1 || tests.FailedInvalid != 1 || tests.Crashed != 1 {
+		t.Errorf("wrong counts: %#v", tests)
+	}
+
+	tests, err = NewRunner(Runner{Decoder: p, Files: files, Validity: "exit-code", RejectExitCodes: []int{2, 65}}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests.PassedValid != 1 || tests.PassedInvalid != 1 {
+		t.Errorf("wrong counts: %#v", tests)
+	}
+	for _, test := range tests.Tests {
+		if test.Diagnostics == "" {
+			t.Errorf("%s: Diagnostics not set", test.Path)
+		}
+	}
+
+	_, err = NewRunner(Runner{Decoder: p, Files: files, Validity: "exit"}).Run()
+	if err == nil {
+		t.Error("no error for unknown Validity")
+	}
+}
+
+func TestInvocation(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		have = make(map[string]Invocation)
+	)
+	r := NewRunner(Runner{
+		Version: "1.1",
+		Env:     []string{"FOO=bar"},
+		Decoder: FuncParser{Decode: func(ctx context.Context, data []byte) (any, error) {
+			inv, _ := InvocationFromContext(ctx)
+			mu.Lock()
+			have[inv.Name] = inv
+			mu.Unlock()
+			return tomlDecode(ctx, data)
+		}},
+		Files: fstest.MapFS{
+			"valid/a.toml":   &fstest.MapFile{Data: []byte(`a=1`)},
+			"valid/a.json":   &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"invalid/b.toml": &fstest.MapFile{Data: []byte(`b=`)},
+		},
+	})
+	if _, err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Invocation{
+		"valid/a":   {Version: "1.1.0", Name: "valid/a", Type: "valid", Env: []string{"FOO=bar"}},
+		"invalid/b": {Version: "1.1.0", Name: "invalid/b", Type: "invalid", Env: []string{"FOO=bar"}},
+	}
+	if h, w := fmt.Sprintf("%v", have), fmt.Sprintf("%v", want); h != w {
+		t.Errorf("\nhave: %s\nwant: %s", h, w)
+	}
+
+	env := strings.Join(have["invalid/b"].Environ(), "\n")
+	for _, w := range []string{"TOML_TEST_VERSION=1.1.0", "TOML_TEST_NAME=invalid/b", "TOML_TEST_TYPE=invalid", "FOO=bar"} {
+		if !strings.Contains(env, "\n"+w) {
+			t.Errorf("%q not in Environ()", w)
+		}
+	}
+
+	_, err := NewRunner(Runner{Env: []string{"FOO"}}).Run()
+	if err == nil {
+		t.Error("no error for invalid Env")
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	var (
+		dec    = FuncParser{Decode: tomlDecode}
+		encode = func(drop string) FuncParser {
+			return FuncParser{Encode: func(ctx context.Context, v any) ([]byte, error) {
+				if m, ok := v.(map[string]any); ok {
+					if _, ok := m["reject"]; ok {
+						return nil, fmt.Errorf("oops")
+					}
+					delete(m, drop)
+				}
+				b := new(strings.Builder)
+				err := toml.NewEncoder(b).Encode(v)
+				return []byte(b.String()), err
+			}}
+		}
+		files = fstest.MapFS{
+			"valid/a.toml":      &fstest.MapFile{Data: []byte(`a = 1`)},
+			"valid/a.json":      &fstest.MapFile{Data: []byte(`{"a": {"type": "integer", "value": "1"}}`)},
+			"valid/b.toml":      &fstest.MapFile{Data: []byte(`b = 1`)},
+			"valid/b.json":      &fstest.MapFile{Data: []byte(`{"b": {"type": "integer", "value": "1"}}`)},
+			"valid/c.toml":      &fstest.MapFile{Data: []byte(`c = 1`)},
+			"valid/c.json":      &fstest.MapFile{Data: []byte(`{"c": {"type": "integer", "value": "2"}}`)},
+			"valid/reject.toml": &fstest.MapFile{Data: []byte(`reject = 1`)},
+			"valid/reject.json": &fstest.MapFile{Data: []byte(`{"reject": {"type": "integer", "value": "1"}}`)},
+		}
+	)
+
+	tests, err := NewRunner(Runner{Decoder: dec, Encoder: encode("b"), Files: files, Roundtrip: true}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"valid/a":      "",
+		"valid/b":      "decode-encoded",
+		"valid/c":      "decode",
+		"valid/reject": "encode",
+	}
+	for _, test := range tests.Tests {
+		if test.Stage != want[test.Path] {
+			t.Errorf("%s: stage %q; want %q (%s)", test.Path, test.Stage, want[test.Path], test.Failure)
+		}
+		if test.Stage != "" && !strings.Contains(test.Failure, "Round-trip failed") {
+			t.Errorf("%s: wrong failure: %s", test.Path, test.Failure)
+		}
+		if test.Stage == "" && test.Input != "a = 1" {
+			t.Errorf("%s: input not the original: %q", test.Path, test.Input)
+		}
+	}
+	if tests.PassedValid != 1 || tests.FailedValid != 3 {
+		t.Errorf("wrong counts: %#v", tests)
+	}
+
+	_, err = NewRunner(Runner{Decoder: dec, Files: files, Roundtrip: true}).Run()
+	if err == nil {
+		t.Error("no error without Encoder")
+	}
+}
+
+func TestEncoderInvalid(t *testing.T) {
+	var (
+		enc = FuncParser{Encode: func(ctx context.Context, v any) ([]byte, error) {
+			b := new(strings.Builder)
+			err := toml.NewEncoder(b).Encode(v)
+			return []byte(b.String()), err
+		}}
+		files = fstest.MapFS{
+			"encoder/a.toml":              &fstest.MapFile{Data: []byte(`a = 1`)},
+			"encoder/a.json":              &fstest.MapFile{Data: []byte(`{"a": {"type": "integer", "value": "1"}}`)},
+			"encoder-invalid/int.json":    &fstest.MapFile{Data: []byte(`{"a": {"type": "integer", "value": "abc"}}`)},
+			"encoder-invalid/type.json":   &fstest.MapFile{Data: []byte(`{"a": {"type": "date", "value": "1979-05-27"}}`)},
+			"encoder-invalid/accept.json": &fstest.MapFile{Data: []byte(`{"a": {"type": "integer", "value": "1"}}`)},
+		}
+	)
+
+	tests, err := NewRunner(Runner{Encoder: enc, Files: files, RunTests: []string{"encoder*/*"}}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests.PassedEncoder != 1 || tests.PassedEncoderInvalid != 2 || tests.FailedEncoderInvalid != 1 {
+		t.Errorf("wrong counts: %#v", tests)
+	}
+	want := []string{"encoder/a", "encoder-invalid/accept", "encoder-invalid/int", "encoder-invalid/type"}
+	for i, test := range tests.Tests {
+		if test.Path != want[i] {
+			t.Errorf("test %d: %q; want %q", i, test.Path, want[i])
+		}
+		if test.Path == "encoder-invalid/accept" && test.Failure != "Expected an error, but no error was reported." {
+			t.Errorf("wrong failure: %q", test.Failure)
+		}
+	}
+
+	tests, err = NewRunner(Runner{Files: files, RunTests: []string{"encoder*/*"}}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests.Tests) != 0 {
+		t.Errorf("ran encoder-invalid tests without Encoder: %#v", tests)
+	}
+}
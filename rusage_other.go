@@ -0,0 +1,11 @@
+//go:build !unix
+
+package tomltest
+
+import "os"
+
+// sysUsage gets the terminating signal and peak RSS of the process. This isn't
+// supported on this platform.
+func sysUsage(ps *os.ProcessState) (signal string, maxRSS int64) {
+	return "", 0
+}
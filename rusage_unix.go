@@ -0,0 +1,23 @@
+//go:build unix
+
+package tomltest
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// sysUsage gets the terminating signal and peak RSS of the process.
+func sysUsage(ps *os.ProcessState) (signal string, maxRSS int64) {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		signal = ws.Signal().String()
+	}
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		maxRSS = int64(ru.Maxrss)
+		if runtime.GOOS != "darwin" && runtime.GOOS != "ios" { // kilobytes, rather than bytes.
+			maxRSS *= 1024
+		}
+	}
+	return signal, maxRSS
+}
@@ -0,0 +1,91 @@
+package tomltest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// RunT runs the tests as subtests of t, so they can be used from "go test".
+//
+// Every test is run with t.Run() using the test path as the name, so you can
+// use e.g. "go test -run 'TomlTest/valid/string'" to run only the string
+// tests. Tests in SkipTests are skipped with t.Skip(), and failures are
+// reported with t.Error().
+//
+// Subtests are run with t.Parallel() if r.Parallel is larger than 1; the "go
+// test -parallel" flag sets the maximum number of tests that are run at the
+// same time.
+func RunT(t *testing.T, r Runner) {
+	t.Helper()
+	if _, err := r.prepare(); err != nil {
+		t.Fatalf("tomltest.RunT: %s", err)
+	}
+
+	// Check the errors against all tests, rather than just the ones that are
+	// run, as "go test -run" may select only some of them.
+	unused := make(map[string]struct{}, len(r.errors))
+	for k, m := range r.errors {
+		if m != nil { // nil if only for a different TOML version.
+			unused[k] = struct{}{}
+		}
+	}
+	for _, p := range r.RunTests {
+		if key, _, ok := r.findErrors(Test{Path: p}.basePath()); ok {
+			delete(unused, key)
+		}
+	}
+	var noMatch []string
+	for k := range unused {
+		noMatch = append(noMatch, k)
+	}
+	if len(noMatch) > 0 {
+		sort.Strings(noMatch)
+		t.Errorf("tomltest.RunT: errors didn't match anything: %q", noMatch)
+	}
+
+	for _, p := range r.RunTests {
+		test := r.newTest(p)
+		if r.Encoder == nil && (test.Encoder() || test.EncoderInvalid()) {
+			continue
+		}
+
+		t.Run(p, func(t *testing.T) {
+			if r.Parallel > 1 {
+				t.Parallel()
+			}
+			if r.hasSkip(test.Path) && !r.SkipMustError {
+				t.Skip("skipped with SkipTests")
+			}
+
+			test, _ := r.checkError(r.runTest(context.Background(), test))
+			test, _ = r.checkPosition(test)
+			if test.Skipped {
+				t.Skip("variant doesn't apply to this test")
+			}
+			if r.SkipMustError && r.hasSkip(test.Path) {
+				if test.Failed() {
+					t.Skipf("skipped with SkipTests, and failed with:\n%s", test.Failure)
+				}
+				t.Error("Test skipped with -skip but didn't fail")
+				return
+			}
+			if test.Failed() {
+				t.Error(test.Failure)
+				t.Logf("input:\n%s", indentT(test.Input))
+				t.Logf("output:\n%s", indentT(test.Output))
+				if !test.Invalid() && !test.EncoderInvalid() {
+					t.Logf("want:\n%s", indentT(test.Want))
+				}
+			}
+			for _, w := range test.Warnings {
+				t.Logf("warning: %s", w)
+			}
+		})
+	}
+}
+
+func indentT(s string) string {
+	return "    " + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n    ")
+}
@@ -0,0 +1,25 @@
+package tomltest
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunT(t *testing.T) {
+	RunT(t, NewRunner(Runner{
+		Decoder:   &testParser{},
+		Parallel:  2,
+		SkipTests: []string{"valid/b"},
+		Files: fstest.MapFS{
+			"valid/a.toml":       &fstest.MapFile{Data: []byte(`a=1`)},
+			"valid/a.json":       &fstest.MapFile{Data: []byte(`{"a": {"type":"integer","value":"1"}}`)},
+			"valid/b.toml":       &fstest.MapFile{Data: []byte(`a=`)},
+			"invalid/a.toml":     &fstest.MapFile{Data: []byte(`a=`)},
+			"invalid/dir/c.toml": &fstest.MapFile{Data: []byte(`c=`)},
+		},
+		Errors: map[string]string{
+			"invalid/a": "oh noes",
+			"dir/c":     "oh noes",
+		},
+	}))
+}
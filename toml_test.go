@@ -31,7 +31,7 @@ func TestCompareTOML(t *testing.T) {
 					continue
 				}
 				t.Run(f, func(t *testing.T) {
-					d, err := os.ReadFile("tests/" + f + ".toml")
+					_, d, err := Test{Path: f}.ReadInput(TestCases())
 					if err != nil {
 						t.Fatal(err)
 					}
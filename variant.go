@@ -0,0 +1,120 @@
+package tomltest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// AllVariants lists all variants of the input that can be used in
+// Runner.Variants.
+//
+// Every valid and invalid test is run again with the input modified, and added
+// as a separate test with the variant name appended to the path (e.g.
+// "valid/string/basic@crlf"):
+//
+//	crlf       Replace all \n with \r\n.
+//	no-eol     Remove the final newline.
+//	comments   Append "# comment" to every line.
+//	bom        Prepend a UTF-8 byte order mark.
+//
+// Variants are skipped if they don't apply to a test: for example adding a
+// comment inside a multi-line string changes the value, and removing the final
+// newline may make an invalid test valid. To find out if a variant applies the
+// original input and variant are decoded with BurntSushi/toml, and the variant
+// is used only if it results in the same value (valid tests), or if both are
+// rejected (invalid tests).
+var AllVariants = []string{"crlf", "no-eol", "comments", "bom"}
+
+type variantSkipError struct{ reason string }
+
+func (err variantSkipError) Error() string { return err.reason }
+
+// applyVariant applies the variant to the input.
+func applyVariant(variant, input string, invalid bool) (string, error) {
+	var (
+		orig   any
+		_, err = toml.Decode(input, &orig)
+	)
+	if invalid && err == nil {
+		return "", variantSkipError{"input is not rejected by BurntSushi/toml"}
+	}
+	if !invalid && err != nil {
+		return "", variantSkipError{"input is rejected by BurntSushi/toml"}
+	}
+
+	var v string
+	switch variant {
+	case "crlf":
+		v = strings.ReplaceAll(strings.ReplaceAll(input, "\r\n", "\n"), "\n", "\r\n")
+	case "no-eol":
+		v = strings.TrimSuffix(strings.TrimSuffix(input, "\n"), "\r")
+	case "bom":
+		v = "\xef\xbb\xbf" + input
+	case "comments":
+		v = addComments(input, orig, invalid)
+	default:
+		return "", fmt.Errorf("unknown variant %q", variant)
+	}
+	if v == input {
+		return "", variantSkipError{"variant doesn't change the input"}
+	}
+
+	if ok, reason := sameResult(orig, v, invalid); !ok {
+		return "", variantSkipError{reason}
+	}
+	return v, nil
+}
+
+// addComments adds a comment to the end of every line. For valid tests, lines
+// where a comment would change the value are left alone.
+func addComments(input string, orig any, invalid bool) string {
+	lines := strings.SplitAfter(input, "\n")
+	for i, l := range lines {
+		if l == "" { // After final newline.
+			continue
+		}
+		eol := ""
+		if strings.HasSuffix(l, "\r\n") {
+			eol = "\r\n"
+		} else if strings.HasSuffix(l, "\n") {
+			eol = "\n"
+		}
+		l = strings.TrimSuffix(l, eol)
+		if l == "" || strings.HasSuffix(l, " ") || strings.HasSuffix(l, "\t") {
+			l += "# comment" + eol
+		} else {
+			l += " # comment" + eol
+		}
+
+		if !invalid {
+			try := strings.Join(lines[:i], "") + l + strings.Join(lines[i+1:], "")
+			if ok, _ := sameResult(orig, try, false); !ok {
+				continue
+			}
+		}
+		lines[i] = l
+	}
+	return strings.Join(lines, "")
+}
+
+// sameResult reports if input is rejected (invalid tests) or decodes to orig
+// (valid tests).
+func sameResult(orig any, input string, invalid bool) (bool, string) {
+	var v any
+	_, err := toml.Decode(input, &v)
+	if invalid {
+		if err == nil {
+			return false, "variant makes the input valid"
+		}
+		return true, ""
+	}
+	if err != nil {
+		return false, "variant makes the input invalid"
+	}
+	if r := (Test{}).CompareTOML(orig, v); r.Failed() {
+		return false, "variant changes the value"
+	}
+	return true, ""
+}
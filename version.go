@@ -1,5 +1,11 @@
 package tomltest
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type versionSpec struct {
 	inherit string
 	exclude []string
@@ -32,7 +38,60 @@ var versions = map[string]versionSpec{
 			"valid/inline-table/newline", // Newlines in inline tables.
 			"valid/inline-table/newline-comment",
 			"valid/key/empty-05",
-			"invalid/control/multi-cr", "invalid/control/rawmulti-cr", // See #174
+			"invalid/control/control.multi#multi-cr", "invalid/control/control.multi#rawmulti-cr", // See #174
 		},
 	},
 }
+
+// Versions gets all supported TOML versions, sorted from oldest to newest.
+func Versions() []string {
+	v := make([]string, 0, len(versions))
+	for k := range versions {
+		v = append(v, k)
+	}
+	sort.Strings(v)
+	return v
+}
+
+// ParseVersions parses a comma-separated list of TOML versions, such as
+// "1.0,1.1". The short versions "1.0" and "1.1", and "latest" are accepted,
+// and "all" is all versions. The returned versions are always the full
+// version, sorted from oldest to newest, without duplicates.
+func ParseVersions(s string) ([]string, error) {
+	if s == "all" {
+		return Versions(), nil
+	}
+	var (
+		list = strings.Split(s, ",")
+		seen = make(map[string]struct{}, len(list))
+		v    = make([]string, 0, len(list))
+	)
+	for _, l := range list {
+		l = normalizeVersion(strings.TrimSpace(l))
+		if _, ok := versions[l]; !ok {
+			return nil, fmt.Errorf("unknown version: %q (supported: \"%s\")",
+				l, strings.Join(append(Versions(), "all"), `", "`))
+		}
+		if _, ok := seen[l]; ok {
+			continue
+		}
+		seen[l] = struct{}{}
+		v = append(v, l)
+	}
+	sort.Strings(v)
+	return v, nil
+}
+
+// normalizeVersion expands "1.0" to "1.0.0", "1.1" and "latest" to "1.1.0", and
+// "" to DefaultVersion.
+func normalizeVersion(v string) string {
+	switch v {
+	case "":
+		return DefaultVersion
+	case "1.0":
+		return "1.0.0"
+	case "1.1", "latest":
+		return "1.1.0"
+	}
+	return v
+}